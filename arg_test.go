@@ -1,6 +1,8 @@
 package flags
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +36,51 @@ func TestPositional(t *testing.T) {
 	assertStringArray(t, opts.Positional.Rest, []string{"a", "b"})
 	assertStringArray(t, ret, []string{})
 }
+
+func TestPositionalRest(t *testing.T) {
+	var opts = struct {
+		Positional struct {
+			Command string   `positional-arg-name:"command"`
+			Pairs   []string `positional-arg-name:"key value" positional-rest:"yes" description:"Pairs of keys and values"`
+		} `positional-args:"yes"`
+	}{}
+
+	p := NewNamedParser("TestPositionalRest", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	ret, err := p.ParseArgs([]string{"set", "a", "1", "b", "2"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Positional.Command, "set")
+	assertStringArray(t, opts.Positional.Pairs, []string{"a", "1", "b", "2"})
+	assertStringArray(t, ret, []string{})
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "[command] [key value...]") {
+		t.Errorf("Expected usage to contain the rest argument, but got:\n%s", buf.String())
+	}
+}
+
+func TestPositionalRestInvalid(t *testing.T) {
+	var notSlice = struct {
+		Positional struct {
+			Rest string `positional-rest:"yes"`
+		} `positional-args:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "positional-rest argument `Rest' must be a slice", &notSlice)
+
+	var notLast = struct {
+		Positional struct {
+			Rest []string `positional-rest:"yes"`
+			Last string
+		} `positional-args:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "positional-rest argument `Rest' must be the last positional argument", &notLast)
+}
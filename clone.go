@@ -0,0 +1,268 @@
+package flags
+
+import (
+	"reflect"
+)
+
+// valueKey identifies a value inside the data of a parser by its address and
+// type (a struct and its first field share the same address).
+type valueKey struct {
+	addr uintptr
+	tp   reflect.Type
+}
+
+// cloner rebinds the groups, options and arguments of a parser to a new data
+// struct of the same type, by locating each bound value through the path of
+// struct fields leading to it.
+type cloner struct {
+	paths map[valueKey][]int
+	data  reflect.Value
+}
+
+// Clone returns a new parser with the same groups, options, commands and
+// settings as p, bound to newData instead of the data given to NewParser.
+// The option metadata is reused from p, so that no struct tags need to be
+// parsed again. newData must be a pointer to a struct of the same type as
+// the data of p, and all groups and commands of p must be part of that data
+// (groups or commands added with separate data, and commands added with
+// AddCommandLazy which have already been used, cannot be cloned). Nil
+// pointers to groups and commands in newData are allocated.
+//
+// The clone does not share any mutable state with p: p and its clones may
+// be used concurrently, each from a single goroutine at a time. The handlers
+// of p (e.g. UnknownOptionHandler) are shared by the clones and need to be
+// safe for concurrent use themselves. Clone must not be called concurrently
+// with a parse of p.
+func (p *Parser) Clone(newData interface{}) (*Parser, error) {
+	newval := reflect.ValueOf(newData)
+
+	if newval.Kind() != reflect.Ptr || newval.IsNil() || newval.Elem().Kind() != reflect.Struct {
+		return nil, ErrNotPointerToStruct
+	}
+
+	var data interface{}
+
+	if len(p.Command.groups) != 0 {
+		data = p.Command.groups[0].data
+	}
+
+	if data == nil || reflect.TypeOf(data) != newval.Type() {
+		return nil, newErrorf(ErrUnknown, "cannot clone parser with data of type %T using data of type %T", data, newData)
+	}
+
+	cl := &cloner{
+		paths: make(map[valueKey][]int),
+		data:  newval.Elem(),
+	}
+
+	cl.collect(reflect.ValueOf(data).Elem(), nil, make(map[uintptr]bool))
+
+	ret := *p
+	ret.state = nil
+
+	cmd, err := cl.cloneCommand(p.Command, &ret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Command = cmd
+	return &ret, nil
+}
+
+// collect records the path of every addressable value reachable from v.
+func (cl *cloner) collect(v reflect.Value, path []int, visited map[uintptr]bool) {
+	key := valueKey{v.UnsafeAddr(), v.Type()}
+
+	if _, ok := cl.paths[key]; !ok {
+		cl.paths[key] = path
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || visited[v.Pointer()] {
+			return
+		}
+
+		visited[v.Pointer()] = true
+		cl.collect(v.Elem(), path, visited)
+	case reflect.Struct:
+		tp := v.Type()
+
+		for i := 0; i < tp.NumField(); i++ {
+			field := tp.Field(i)
+
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+
+			cl.collect(v.Field(i), append(path[:len(path):len(path)], i), visited)
+		}
+	}
+}
+
+// resolve returns the value in the new data corresponding to v, which must be
+// a value inside the data of the cloned parser.
+func (cl *cloner) resolve(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, true
+	}
+
+	if !v.CanAddr() {
+		return reflect.Value{}, false
+	}
+
+	path, ok := cl.paths[valueKey{v.UnsafeAddr(), v.Type()}]
+
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	ret := cl.data
+
+	for _, i := range path {
+		ret = allocIndirect(ret).Field(i)
+	}
+
+	if ret.Type() != v.Type() {
+		ret = allocIndirect(ret)
+	}
+
+	return ret, true
+}
+
+// allocIndirect dereferences v if it is a pointer, allocating a new value if
+// the pointer is nil.
+func allocIndirect(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Ptr {
+		return v
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+
+	return v.Elem()
+}
+
+func (cl *cloner) cloneCommand(c *Command, parent interface{}) (*Command, error) {
+	if c.factory == nil && c.data != nil {
+		if _, ok := cl.resolve(reflect.ValueOf(c.data).Elem()); !ok {
+			return nil, newErrorf(ErrUnknown, "cannot clone command `%s' which is not part of the parser data", c.Name)
+		}
+	}
+
+	ret := *c
+	ret.Active = nil
+	ret.hasBuiltinHelpGroup = false
+	ret.hasBuiltinVersionGroup = false
+
+	group, err := cl.cloneGroup(c.Group, parent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Group = group
+	ret.groups = nil
+
+	for _, g := range c.groups {
+		// The built-in help and version groups are bound to the parser and
+		// are added again by the clone when it is parsed
+		if g.isBuiltinHelp {
+			continue
+		}
+
+		cg, err := cl.cloneGroup(g, &ret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret.groups = append(ret.groups, cg)
+	}
+
+	ret.commands = make([]*Command, 0, len(c.commands))
+
+	for _, sc := range c.commands {
+		csc, err := cl.cloneCommand(sc, &ret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret.commands = append(ret.commands, csc)
+	}
+
+	ret.args = make([]*Arg, 0, len(c.args))
+
+	for _, arg := range c.args {
+		carg := *arg
+		value, ok := cl.resolve(arg.value)
+
+		if !ok {
+			return nil, newErrorf(ErrUnknown, "cannot clone positional argument `%s' which is not part of the parser data", arg.Name)
+		}
+
+		carg.value = value
+		ret.args = append(ret.args, &carg)
+	}
+
+	return &ret, nil
+}
+
+func (cl *cloner) cloneGroup(g *Group, parent interface{}) (*Group, error) {
+	ret := *g
+	ret.parent = parent
+
+	if g.data != nil {
+		data, ok := cl.resolve(reflect.ValueOf(g.data).Elem())
+
+		if !ok {
+			return nil, newErrorf(ErrUnknown, "cannot clone group `%s' which is not part of the parser data", g.ShortDescription)
+		}
+
+		ret.data = data.Addr().Interface()
+	}
+
+	passthrough, ok := cl.resolve(g.passthrough)
+
+	if !ok {
+		return nil, newErrorf(ErrUnknown, "cannot clone passthrough field of group `%s' which is not part of the parser data", g.ShortDescription)
+	}
+
+	ret.passthrough = passthrough
+	ret.options = make([]*Option, 0, len(g.options))
+
+	for _, option := range g.options {
+		copt := *option
+		value, ok := cl.resolve(option.value)
+
+		if !ok {
+			return nil, newErrorf(ErrUnknown, "cannot clone flag `%s' which is not part of the parser data", option)
+		}
+
+		copt.group = &ret
+		copt.value = value
+		copt.isSet = false
+		copt.isSetDefault = false
+		copt.source = SourceDefault
+		copt.opened = nil
+
+		ret.options = append(ret.options, &copt)
+	}
+
+	ret.groups = make([]*Group, 0, len(g.groups))
+
+	for _, sg := range g.groups {
+		csg, err := cl.cloneGroup(sg, &ret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ret.groups = append(ret.groups, csg)
+	}
+
+	return &ret, nil
+}
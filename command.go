@@ -24,15 +24,55 @@ type Command struct {
 	// Whether subcommands are optional
 	SubcommandsOptional bool
 
+	// Whether a subcommand is required, even if SubcommandsOptional is set.
+	// When no subcommand is given, parsing fails with an ErrCommandRequired
+	// error listing the available commands
+	SubcommandsRequired bool
+
 	// Aliases for the command
 	Aliases []string
 
 	// Whether positional arguments are required
 	ArgsRequired bool
 
-	commands            []*Command
-	hasBuiltinHelpGroup bool
-	args                []*Arg
+	// A description of the positional arguments, shown below the arguments
+	// heading in the help. It is set by the description tag of the
+	// positional-args field.
+	ArgsDescription string
+
+	// A text written after all other sections of the help of the command
+	// (e.g. a link to the documentation), wrapped to the terminal width.
+	// The epilogue of the parser is also written in the help of its
+	// subcommands, after the epilogue of the command. The man page renders
+	// the epilogue as a trailing paragraph of the description
+	Epilogue string
+
+	// PreParse is called when the command becomes active while parsing,
+	// with the arguments following the command name. The returned arguments
+	// are parsed instead (e.g. to expand macros), and an error aborts
+	// parsing. It is called before any option or subcommand of the command
+	// is parsed, and therefore long before the command is executed by
+	// Parser.Execute or passed to the CommandHandler, which only happens
+	// after all arguments have been parsed
+	PreParse func(args []string) ([]string, error)
+
+	// The category of the command. Commands sharing a category are listed
+	// together under the category name in the help and man page
+	Category string
+
+	// Whether the subcommands of the command are hidden. Hidden subcommands,
+	// and all of their descendants, are not shown in the help, man page or
+	// completion, but can still be invoked (including their help)
+	HideSubcommands bool
+
+	commands               []*Command
+	hasBuiltinHelpGroup    bool
+	hasBuiltinVersionGroup bool
+	args                   []*Arg
+
+	// Creates the command data on first use for commands added with
+	// AddCommandLazy, nil once the data has been created
+	factory func() interface{}
 }
 
 // Commander is an interface which can be implemented by any command added in
@@ -59,15 +99,22 @@ type lookup struct {
 	longNames  map[string]*Option
 
 	commands map[string]*Command
+
+	passthrough reflect.Value
 }
 
 // AddCommand adds a new command to the parser with the given name and data. The
 // data needs to be a pointer to a struct from which the fields indicate which
 // options are in the command. The provided data can implement the Command and
-// Usage interfaces.
+// Usage interfaces. An error of type ErrDuplicatedCommand is returned if the
+// name is already used by another subcommand, either as its name or alias.
 func (c *Command) AddCommand(command string, shortDescription string, longDescription string, data interface{}) (*Command, error) {
 	cmd := newCommand(command, shortDescription, longDescription, data)
 
+	if err := checkDuplicateCommands(append(c.commands[:len(c.commands):len(c.commands)], cmd)); err != nil {
+		return nil, err
+	}
+
 	cmd.parent = c
 
 	if err := cmd.scan(); err != nil {
@@ -78,6 +125,29 @@ func (c *Command) AddCommand(command string, shortDescription string, longDescri
 	return cmd, nil
 }
 
+// AddCommandLazy adds a new command to the parser with the given name, like
+// AddCommand. Instead of the command data, a factory is provided which is
+// only called once the command is actually needed, i.e. when it is selected
+// on the command line or when detailed information on its options is
+// required (such as when writing a man page). Listing the command in the help
+// does not create its data. The factory must return a pointer to a struct,
+// which can implement the Command and Usage interfaces. A name already used
+// by another command is reported right away, errors in the option struct are
+// reported when the command is first used.
+func (c *Command) AddCommandLazy(command string, shortDescription string, longDescription string, factory func() interface{}) (*Command, error) {
+	cmd := newCommand(command, shortDescription, longDescription, nil)
+
+	if err := checkDuplicateCommands(append(c.commands[:len(c.commands):len(c.commands)], cmd)); err != nil {
+		return nil, err
+	}
+
+	cmd.parent = c
+	cmd.factory = factory
+
+	c.commands = append(c.commands, cmd)
+	return cmd, nil
+}
+
 // AddGroup adds a new group to the command with the given name and data. The
 // data needs to be a pointer to a struct from which the fields indicate which
 // options are in the group.
@@ -111,9 +181,24 @@ func (c *Command) Find(name string) *Command {
 	return nil
 }
 
+// ActivePath returns the chain of active commands, starting with the command
+// itself and followed by its active subcommand, the active subcommand of that
+// command, and so on.
+func (c *Command) ActivePath() []*Command {
+	var path []*Command
+
+	for cmd := c; cmd != nil; cmd = cmd.Active {
+		path = append(path, cmd)
+	}
+
+	return path
+}
+
 // FindOptionByLongName finds an option that is part of the command, or any of
 // its parent commands, by matching its long name (including the option
-// namespace).
+// namespace). The options of the command itself take precedence over those of
+// its parents, and options of subcommands are never found. Use
+// c.Group.FindOptionByLongName to search the command without its parents.
 func (c *Command) FindOptionByLongName(longName string) (option *Option) {
 	for option == nil && c != nil {
 		option = c.Group.FindOptionByLongName(longName)
@@ -125,8 +210,9 @@ func (c *Command) FindOptionByLongName(longName string) (option *Option) {
 }
 
 // FindOptionByShortName finds an option that is part of the command, or any of
-// its parent commands, by matching its long name (including the option
-// namespace).
+// its parent commands, by matching its short name or one of its short
+// aliases. Like FindOptionByLongName, the options of the command itself take
+// precedence and options of subcommands are never found.
 func (c *Command) FindOptionByShortName(shortName rune) (option *Option) {
 	for option == nil && c != nil {
 		option = c.Group.FindOptionByShortName(shortName)
@@ -163,6 +249,8 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 		positional := mtag.Get("positional-args")
 
 		if len(positional) != 0 {
+			c.ArgsDescription = mtag.Get("description")
+
 			stype := realval.Type()
 
 			for i := 0; i < stype.NumField(); i++ {
@@ -180,6 +268,20 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 					name = field.Name
 				}
 
+				if !isStringFalsy(m.Get("positional-rest")) {
+					if field.Type.Kind() != reflect.Slice {
+						return true, newErrorf(ErrInvalidTag,
+							"positional-rest argument `%s' must be a slice",
+							name)
+					}
+
+					if i != stype.NumField()-1 {
+						return true, newErrorf(ErrInvalidTag,
+							"positional-rest argument `%s' must be the last positional argument",
+							name)
+					}
+				}
+
 				required := -1
 				requiredMaximum := -1
 
@@ -243,6 +345,7 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 			shortDescription := mtag.Get("description")
 			longDescription := mtag.Get("long-description")
 			subcommandsOptional := mtag.Get("subcommands-optional")
+			subcommandsRequired := mtag.Get("subcommands-required")
 			aliases := mtag.GetMany("alias")
 
 			subc, err := c.AddCommand(subcommand, shortDescription, longDescription, ptrval.Interface())
@@ -252,13 +355,23 @@ func (c *Command) scanSubcommandHandler(parentg *Group) scanHandler {
 			}
 
 			subc.Hidden = mtag.Get("hidden") != ""
+			subc.HideSubcommands = mtag.Get("hide-subcommands") != ""
+			subc.Category = mtag.Get("category")
 
 			if len(subcommandsOptional) > 0 {
 				subc.SubcommandsOptional = true
 			}
 
+			if len(subcommandsRequired) > 0 {
+				subc.SubcommandsRequired = true
+			}
+
 			if len(aliases) > 0 {
 				subc.Aliases = aliases
+
+				if err := checkDuplicateCommands(c.commands); err != nil {
+					return true, err
+				}
 			}
 
 			return true, nil
@@ -274,6 +387,19 @@ func (c *Command) scan() error {
 	return c.scanType(c.scanSubcommandHandler(c.Group))
 }
 
+// load creates and scans the data of a command added with AddCommandLazy. It
+// does nothing for commands whose data is already available.
+func (c *Command) load() error {
+	if c.factory == nil {
+		return nil
+	}
+
+	c.data = c.factory()
+	c.factory = nil
+
+	return c.scan()
+}
+
 func (c *Command) eachOption(f func(*Command, *Group, *Option)) {
 	c.eachCommand(func(c *Command) {
 		c.eachGroup(func(g *Group) {
@@ -296,6 +422,12 @@ func (c *Command) eachCommand(f func(*Command), recurse bool) {
 	}
 }
 
+// requiresSubcommand returns whether the command has subcommands of which
+// one needs to be specified.
+func (c *Command) requiresSubcommand() bool {
+	return len(c.commands) != 0 && (c.SubcommandsRequired || !c.SubcommandsOptional)
+}
+
 func (c *Command) eachActiveGroup(f func(cc *Command, g *Group)) {
 	c.eachGroup(func(g *Group) {
 		f(c, g)
@@ -317,6 +449,43 @@ func (c *Command) addHelpGroups(showHelp func() error) {
 	}
 }
 
+func (c *Command) addVersionGroup(showVersion func() error) *Group {
+	var version struct {
+		ShowVersion func() error `long:"version" description:"Show version information"`
+	}
+
+	version.ShowVersion = showVersion
+	ret, _ := c.AddGroup("Version Options", "", &version)
+
+	// Treat the group like the built-in help group, so that it does not
+	// count as an option of the application in the usage
+	ret.isBuiltinHelp = true
+	ret.isBuiltinVersion = true
+
+	return ret
+}
+
+// checkDuplicateCommands returns an ErrDuplicatedCommand error if any name or
+// alias is used by more than one of the given commands, or more than once by
+// the same command.
+func checkDuplicateCommands(commands []*Command) *Error {
+	names := make(map[string]*Command)
+
+	for _, cmd := range commands {
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if other, ok := names[name]; ok {
+				return newErrorf(ErrDuplicatedCommand,
+					"command `%s' uses the name `%s' which is already used by command `%s'",
+					cmd.Name, name, other.Name)
+			}
+
+			names[name] = cmd
+		}
+	}
+
+	return nil
+}
+
 func (c *Command) makeLookup() lookup {
 	ret := lookup{
 		shortNames: make(map[string]*Option),
@@ -345,11 +514,47 @@ func (c *Command) makeLookup() lookup {
 	return ret
 }
 
+// longPrefix returns the option of which the long name starts with prefix,
+// or nil if there is no such option. Hidden options are not matched. An
+// ErrAmbiguousFlag error is returned if more than one option matches.
+func (l *lookup) longPrefix(prefix string) (*Option, error) {
+	var match *Option
+	var names []string
+
+	for name, option := range l.longNames {
+		if strings.HasPrefix(name, prefix) && !option.isHidden() {
+			match = option
+			names = append(names, name)
+		}
+	}
+
+	if len(names) > 1 {
+		sort.Strings(names)
+
+		return nil, newErrorf(ErrAmbiguousFlag,
+			"ambiguous flag `%s' could be any of `%s'",
+			prefix,
+			strings.Join(names, "', `"))
+	}
+
+	return match, nil
+}
+
 func (c *Command) fillLookup(ret *lookup, onlyOptions bool) {
 	c.eachGroup(func(g *Group) {
+		if g.passthrough.IsValid() {
+			ret.passthrough = g.passthrough
+		}
+
 		for _, option := range g.options {
-			if option.ShortName != 0 {
-				ret.shortNames[string(option.ShortName)] = option
+			// Options which are not available on this operating system
+			// are treated as unknown
+			if !option.isAvailable() {
+				continue
+			}
+
+			for _, shortName := range option.shortNames() {
+				ret.shortNames[string(shortName)] = option
 			}
 
 			if len(option.LongName) > 0 {
@@ -391,6 +596,19 @@ func (c *Command) groupByName(name string) *Group {
 	return nil
 }
 
+// commandOfGroup returns the command owning the group g, which has c as its
+// parent. This is either one of the subcommands of c (when g is the top-level
+// group of that subcommand), or c itself.
+func (c *Command) commandOfGroup(g *Group) *Command {
+	for _, subc := range c.commands {
+		if subc.Group == g {
+			return subc
+		}
+	}
+
+	return c
+}
+
 type commandList []*Command
 
 func (c commandList) Less(i, j int) bool {
@@ -413,6 +631,10 @@ func (c *Command) sortedVisibleCommands() []*Command {
 }
 
 func (c *Command) visibleCommands() []*Command {
+	if c.HideSubcommands {
+		return nil
+	}
+
 	ret := make([]*Command, 0, len(c.commands))
 
 	for _, cmd := range c.commands {
@@ -424,6 +646,46 @@ func (c *Command) visibleCommands() []*Command {
 	return ret
 }
 
+type commandCategory struct {
+	Name     string
+	Commands []*Command
+}
+
+// visibleCommandCategories returns the visible subcommands split by category.
+// Commands without a category come first (sorted by name), followed by each
+// category in order of first appearance with its commands in declaration
+// order.
+func (c *Command) visibleCommandCategories() []commandCategory {
+	var uncategorized []*Command
+	var ret []commandCategory
+
+	index := make(map[string]int)
+
+	for _, cmd := range c.visibleCommands() {
+		if cmd.Category == "" {
+			uncategorized = append(uncategorized, cmd)
+			continue
+		}
+
+		i, ok := index[cmd.Category]
+
+		if !ok {
+			i = len(ret)
+			index[cmd.Category] = i
+			ret = append(ret, commandCategory{Name: cmd.Category})
+		}
+
+		ret[i].Commands = append(ret[i].Commands, cmd)
+	}
+
+	if len(uncategorized) > 0 {
+		sort.Sort(commandList(uncategorized))
+		ret = append([]commandCategory{{Commands: uncategorized}}, ret...)
+	}
+
+	return ret
+}
+
 func (c *Command) match(name string) bool {
 	if c.Name == name {
 		return true
@@ -1,6 +1,9 @@
 package flags
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -359,6 +362,126 @@ func TestCommandAdd(t *testing.T) {
 	}
 }
 
+func TestCommandAddLazy(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+	}{}
+
+	type lazyCommand struct {
+		G bool `short:"g"`
+	}
+
+	var created []string
+	var cmd1, cmd2 *lazyCommand
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.AddCommandLazy("cmd1", "First command", "", func() interface{} {
+		created = append(created, "cmd1")
+		cmd1 = &lazyCommand{}
+		return cmd1
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := p.AddCommandLazy("cmd2", "Second command", "", func() interface{} {
+		created = append(created, "cmd2")
+		cmd2 = &lazyCommand{}
+		return cmd2
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err := p.AddCommandLazy("cmd1", "Duplicated command", "", func() interface{} {
+		return &lazyCommand{}
+	})
+	assertError(t, err, ErrDuplicatedCommand, "command `cmd1' uses the name `cmd1' which is already used by command `cmd1'")
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if len(created) != 0 {
+		t.Fatalf("Expected no command to be created by the help, but got %v", created)
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "cmd2", "-g", "rest"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"rest"})
+	assertStringArray(t, created, []string{"cmd2"})
+
+	if len(p.Commands()) != 2 {
+		t.Errorf("Expected 2 commands, but got %d", len(p.Commands()))
+	}
+
+	if !cmd2.G {
+		t.Errorf("Expected cmd2.G to be true")
+	}
+
+	if p.Active.data != cmd2 {
+		t.Errorf("Expected cmd2 to be the active command")
+	}
+}
+
+type lazyDefaulterCommand struct {
+	Jobs int `long:"jobs" description:"Number of jobs"`
+}
+
+func (c *lazyDefaulterCommand) SetDefaults() {
+	c.Jobs = 4
+}
+
+func TestCommandAddLazyManPage(t *testing.T) {
+	p := NewNamedParser("test", PrintErrors)
+
+	var build *lazyDefaulterCommand
+
+	if _, err := p.AddCommandLazy("build", "Build things", "", func() interface{} {
+		build = &lazyDefaulterCommand{}
+		return build
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := p.AddCommandLazy("broken", "Broken command", "", func() interface{} {
+		return &struct {
+			Value bool `short:"vv"`
+		}{}
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf, errBuf bytes.Buffer
+	p.ErrorWriter = &errBuf
+
+	p.WriteManPage(&buf)
+
+	if !strings.Contains(buf.String(), "\\-\\-jobs") {
+		t.Errorf("Expected the options of the lazy command in the man page, but got:\n%s", buf.String())
+	}
+
+	// The lazy command is readied as for parsing
+	if build == nil || build.Jobs != 4 {
+		t.Errorf("Expected the defaults of the lazy command to be applied")
+	}
+
+	if strings.Contains(buf.String(), "broken") {
+		t.Errorf("Expected the broken command to be left out, but got:\n%s", buf.String())
+	}
+
+	assertString(t, errBuf.String(), "short names can only be 1 character long, not `vv'\n")
+
+	// Nothing is completed for the broken command
+	comp := &completion{parser: p}
+
+	if items := comp.complete([]string{"broken", "-"}); len(items) != 0 {
+		t.Errorf("Expected no completions, but got %v", items)
+	}
+}
+
 func TestCommandNestedInline(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v"`
@@ -465,6 +588,37 @@ func TestSubcommandsOptionalAfterNonCommand(t *testing.T) {
 	assertStringArray(t, retargs, []string{"nocmd", "remove"})
 }
 
+func TestSubcommandsRequired(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Cmd1 struct {
+		} `command:"remove"`
+
+		Cmd2 struct {
+			Sub struct {
+			} `command:"sub"`
+		} `command:"add" subcommands-optional:"yes" subcommands-required:"yes"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.SubcommandsOptional = true
+	p.SubcommandsRequired = true
+
+	_, err := p.ParseArgs([]string{"-v"})
+	assertError(t, err, ErrCommandRequired, "Please specify one command of: add or remove")
+
+	_, err = p.ParseArgs([]string{"nocmd"})
+	assertError(t, err, ErrUnknownCommand, "Unknown command `nocmd'. Please specify one command of: add or remove")
+
+	_, err = p.ParseArgs([]string{"add"})
+	assertError(t, err, ErrCommandRequired, "Please specify the sub command")
+
+	if _, err := p.ParseArgs([]string{"add", "sub"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestCommandAlias(t *testing.T) {
 	var opts = struct {
 		Command struct {
@@ -504,6 +658,50 @@ func TestSubCommandFindOptionByLongFlag(t *testing.T) {
 	assertString(t, opt.LongName, "testing")
 }
 
+func TestSubCommandFindOptionByLongFlagScoped(t *testing.T) {
+	var opts struct {
+		Output  string `long:"output"`
+		Verbose bool   `long:"verbose"`
+
+		Build struct {
+			Output string `long:"output"`
+		} `command:"build"`
+
+		Test struct {
+			Output string `long:"output"`
+			Short  bool   `long:"short"`
+		} `command:"test"`
+	}
+
+	p := NewParser(&opts, Default)
+	build := p.Find("build")
+	test := p.Find("test")
+
+	if opt := build.FindOptionByLongName("output"); opt == nil || opt.Command() != build {
+		t.Errorf("Expected to find option `output' of command `build'")
+	}
+
+	if opt := test.FindOptionByLongName("output"); opt == nil || opt.Command() != test {
+		t.Errorf("Expected to find option `output' of command `test'")
+	}
+
+	if opt := p.FindOptionByLongName("output"); opt == nil || opt.Command() != p.Command {
+		t.Errorf("Expected to find option `output' of the parser")
+	}
+
+	if opt := p.FindOptionByLongName("short"); opt != nil {
+		t.Errorf("Expected not to find option `short' of a subcommand")
+	}
+
+	if opt := test.Group.FindOptionByLongName("verbose"); opt != nil {
+		t.Errorf("Expected not to find option `verbose' of the parent in the command group")
+	}
+
+	if opt := test.FindOptionByLongName("verbose"); opt == nil {
+		t.Errorf("Expected to find option `verbose' of the parent")
+	}
+}
+
 func TestSubCommandFindOptionByShortFlag(t *testing.T) {
 	var opts struct {
 		Testing bool `short:"t" description:"Testing"`
@@ -604,3 +802,199 @@ func TestCommandPassAfterNonOptionWithPositional(t *testing.T) {
 	assertStringArray(t, opts.Bar.args, []string{})
 	assertStringArray(t, opts.Bar.Positional.Args, []string{"baz", "-v", "-g"})
 }
+
+func TestCommandOptionOwner(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Command struct {
+			G bool `short:"g"`
+
+			Sub struct {
+				Nested struct {
+					S bool `short:"s"`
+				} `group:"nested"`
+			} `command:"sub"`
+		} `command:"cmd"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	extra, err := p.AddGroup("Extra", "", &struct {
+		E bool `short:"e"`
+	}{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cmd := p.Find("cmd")
+	sub := cmd.Find("sub")
+
+	owners := map[rune]*Command{
+		'v': p.Command,
+		'e': p.Command,
+		'g': cmd,
+		's': sub,
+	}
+
+	for name, owner := range owners {
+		option := sub.FindOptionByShortName(name)
+
+		if option == nil {
+			t.Fatalf("Expected to find option `%c'", name)
+		}
+
+		if option.Command() != owner {
+			t.Errorf("Expected option `%c' to belong to command %q, but got %v", name, owner.Name, option.Command())
+		}
+	}
+
+	if o := p.FindOptionByShortName('e'); o.Group() != extra {
+		t.Errorf("Expected option `e' to belong to the extra group")
+	}
+
+	if o := sub.FindOptionByShortName('s'); o.Group().ShortDescription != "nested" {
+		t.Errorf("Expected option `s' to belong to the nested group, but got %q", o.Group().ShortDescription)
+	}
+}
+
+func TestCommandActivePath(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Remote struct {
+			Add struct {
+			} `command:"add"`
+		} `command:"remote"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	if p.ActiveCommand() != nil {
+		t.Errorf("Expected no active command before parsing")
+	}
+
+	if _, err := p.ParseArgs([]string{"-v", "remote", "add"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	remote := p.Find("remote")
+	add := remote.Find("add")
+
+	if p.ActiveCommand() != add {
+		t.Errorf("Expected active command `add', but got %v", p.ActiveCommand())
+	}
+
+	path := p.ActivePath()
+
+	if len(path) != 3 || path[0] != p.Command || path[1] != remote || path[2] != add {
+		t.Errorf("Unexpected active path %v", path)
+	}
+
+	if path := add.ActivePath(); len(path) != 1 || path[0] != add {
+		t.Errorf("Unexpected active path of `add' %v", path)
+	}
+}
+
+func TestCommandDuplicateName(t *testing.T) {
+	p := NewNamedParser("test", None)
+
+	if _, err := p.AddCommand("add", "", "", &struct{}{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err := p.AddCommand("add", "", "", &struct{}{})
+	assertError(t, err, ErrDuplicatedCommand, "command `add' uses the name `add' which is already used by command `add'")
+
+	if len(p.Commands()) != 1 {
+		t.Errorf("Expected the duplicate command not to be added")
+	}
+}
+
+func TestCommandDuplicateAlias(t *testing.T) {
+	var nameAlias = struct {
+		Add struct {
+		} `command:"add"`
+
+		Append struct {
+		} `command:"append" alias:"add"`
+	}{}
+
+	assertParseFail(t, ErrDuplicatedCommand, "command `append' uses the name `add' which is already used by command `add'", &nameAlias)
+
+	var aliasAlias = struct {
+		Add struct {
+		} `command:"add" alias:"a"`
+
+		Append struct {
+		} `command:"append" alias:"a"`
+	}{}
+
+	assertParseFail(t, ErrDuplicatedCommand, "command `append' uses the name `a' which is already used by command `add'", &aliasAlias)
+
+	p := NewNamedParser("test", None)
+	p.AddCommand("add", "", "", &struct{}{})
+	remove, _ := p.AddCommand("remove", "", "", &struct{}{})
+	remove.Aliases = []string{"add"}
+
+	_, err := p.ParseArgs([]string{"add"})
+	assertError(t, err, ErrDuplicatedCommand, "command `remove' uses the name `add' which is already used by command `add'")
+}
+
+func TestCommandPreParse(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Command struct {
+			Force bool `short:"f"`
+			Level int  `long:"level"`
+		} `command:"cmd"`
+	}{}
+
+	p := NewParser(&opts, None)
+	cmd := p.Find("cmd")
+
+	var preParseArgs []string
+
+	cmd.PreParse = func(args []string) ([]string, error) {
+		preParseArgs = args
+
+		ret := []string{}
+
+		for _, arg := range args {
+			if arg == "@all" {
+				ret = append(ret, "-f", "--level", "3")
+			} else {
+				ret = append(ret, arg)
+			}
+		}
+
+		return ret, nil
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "cmd", "@all", "rest"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, preParseArgs, []string{"@all", "rest"})
+	assertStringArray(t, ret, []string{"rest"})
+
+	if !opts.Value || !opts.Command.Force || opts.Command.Level != 3 {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	consumed, remaining := p.LastArgs()
+	assertStringArray(t, consumed, []string{"-v", "cmd", "-f", "--level", "3", "rest"})
+	assertStringArray(t, remaining, []string{})
+
+	cmd.PreParse = func(args []string) ([]string, error) {
+		return nil, errors.New("invalid macro")
+	}
+
+	if _, err := p.ParseArgs([]string{"cmd", "-f"}); err == nil || err.Error() != "invalid macro" {
+		t.Errorf("Expected error `invalid macro', but got %v", err)
+	}
+}
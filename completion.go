@@ -17,6 +17,10 @@ type Completion struct {
 
 	// A description of the completed item (optional)
 	Description string
+
+	// The name of the argument value expected by a completed option, as
+	// given by its value-name tag (optional)
+	ValueName string
 }
 
 type completions []Completion
@@ -34,7 +38,11 @@ func (c completions) Swap(i, j int) {
 }
 
 // Completer is an interface which can be implemented by types
-// to provide custom command line argument completion.
+// to provide custom command line argument completion. When completing the
+// argument of an option (e.g. --branch <TAB> or --branch=<TAB>) or a
+// positional argument, Complete is called on the field, or on a new zero
+// element for slices, so it can provide dynamic completions (e.g. listing
+// remote branches). The completion tag takes precedence over Completer.
 type Completer interface {
 	// Complete receives a prefix representing a (partial) value
 	// for its type and should provide a list of possible valid
@@ -62,7 +70,26 @@ func completionsWithoutDescriptions(items []string) []Completion {
 // Complete returns a list of existing files with the given
 // prefix.
 func (f *Filename) Complete(match string) []Completion {
+	return completeFilenames(match, false)
+}
+
+// completeFilenames returns a list of existing files, or only directories if
+// dirsOnly is set, with the given prefix.
+func completeFilenames(match string, dirsOnly bool) []Completion {
 	ret, _ := filepath.Glob(match + "*")
+
+	if dirsOnly {
+		dirs := ret[:0]
+
+		for _, name := range ret {
+			if info, err := os.Stat(name); err == nil && info.IsDir() {
+				dirs = append(dirs, name)
+			}
+		}
+
+		ret = dirs
+	}
+
 	if len(ret) == 1 {
 		if info, err := os.Stat(ret[0]); err == nil && info.IsDir() {
 			ret[0] = ret[0] + "/"
@@ -92,10 +119,11 @@ func (c *completion) completeOptionNames(s *parseState, prefix string, match str
 	repeats := map[string]bool{}
 
 	for name, opt := range s.lookup.longNames {
-		if strings.HasPrefix(name, match) && !opt.Hidden {
+		if strings.HasPrefix(name, match) && !opt.isHidden() {
 			results = append(results, Completion{
 				Item:        defaultLongOptDelimiter + name,
-				Description: opt.Description,
+				Description: opt.description(),
+				ValueName:   opt.completionValueName(),
 			})
 
 			if short {
@@ -106,10 +134,11 @@ func (c *completion) completeOptionNames(s *parseState, prefix string, match str
 
 	if short {
 		for name, opt := range s.lookup.shortNames {
-			if _, exist := repeats[name]; !exist && strings.HasPrefix(name, match) && !opt.Hidden {
+			if _, exist := repeats[name]; !exist && strings.HasPrefix(name, match) && !opt.isHidden() {
 				results = append(results, Completion{
 					Item:        string(defaultShortOptDelimiter) + name,
-					Description: opt.Description,
+					Description: opt.description(),
+					ValueName:   opt.completionValueName(),
 				})
 			}
 		}
@@ -129,8 +158,8 @@ func (c *completion) completeNamesForShortPrefix(s *parseState, prefix string, m
 func (c *completion) completeCommands(s *parseState, match string) []Completion {
 	n := make([]Completion, 0, len(s.command.commands))
 
-	for _, cmd := range s.command.commands {
-		if cmd.data != c && !cmd.Hidden && strings.HasPrefix(cmd.Name, match) {
+	for _, cmd := range s.command.visibleCommands() {
+		if cmd.data != c && strings.HasPrefix(cmd.Name, match) {
 			n = append(n, Completion{
 				Item:        cmd.Name,
 				Description: cmd.ShortDescription,
@@ -141,7 +170,7 @@ func (c *completion) completeCommands(s *parseState, match string) []Completion
 	return n
 }
 
-func (c *completion) completeValue(value reflect.Value, prefix string, match string) []Completion {
+func (c *completion) completeValue(value reflect.Value, tag multiTag, prefix string, match string) []Completion {
 	if value.Kind() == reflect.Slice {
 		value = reflect.New(value.Type().Elem())
 	}
@@ -149,7 +178,9 @@ func (c *completion) completeValue(value reflect.Value, prefix string, match str
 
 	var ret []Completion
 
-	if cmp, ok := i.(Completer); ok {
+	if kind := tag.Get("completion"); kind == "filename" || kind == "dirname" {
+		ret = completeFilenames(match, kind == "dirname")
+	} else if cmp, ok := i.(Completer); ok {
 		ret = cmp.Complete(match)
 	} else if value.CanAddr() {
 		if cmp, ok = value.Addr().Interface().(Completer); ok {
@@ -180,7 +211,7 @@ func (c *completion) complete(args []string) []Completion {
 	for len(s.args) > 1 {
 		arg := s.pop()
 
-		if (c.parser.Options&PassDoubleDash) != None && arg == "--" {
+		if (c.parser.Options&PassDoubleDash) != None && c.parser.isArgsTerminator(arg) {
 			opt = nil
 			c.skipPositional(s, len(s.args)-1)
 
@@ -234,6 +265,11 @@ func (c *completion) complete(args []string) []Completion {
 					s.positional = s.positional[1:]
 				}
 			} else if cmd, ok := s.lookup.commands[arg]; ok {
+				// Nothing can be completed for a command which fails to load
+				if err := c.parser.loadCommand(cmd); err != nil {
+					return nil
+				}
+
 				cmd.fillParseState(s)
 			}
 
@@ -246,7 +282,7 @@ func (c *completion) complete(args []string) []Completion {
 
 	if opt != nil {
 		// Completion for the argument of 'opt'
-		ret = c.completeValue(opt.value, "", lastarg)
+		ret = c.completeValue(opt.value, opt.tag, "", lastarg)
 	} else if argumentStartsOption(lastarg) {
 		// Complete the option
 		prefix, optname, islong := stripOptionPrefix(lastarg)
@@ -257,7 +293,7 @@ func (c *completion) complete(args []string) []Completion {
 			sname := string(rname)
 
 			if opt := s.lookup.shortNames[sname]; opt != nil && opt.canArgument() {
-				ret = c.completeValue(opt.value, prefix+sname, optname[n:])
+				ret = c.completeValue(opt.value, opt.tag, prefix+sname, optname[n:])
 			} else {
 				ret = c.completeNamesForShortPrefix(s, prefix, optname)
 			}
@@ -269,7 +305,7 @@ func (c *completion) complete(args []string) []Completion {
 			}
 
 			if opt != nil {
-				ret = c.completeValue(opt.value, prefix+optname+split, *argument)
+				ret = c.completeValue(opt.value, opt.tag, prefix+optname+split, *argument)
 			}
 		} else if islong {
 			ret = c.completeNamesForLongPrefix(s, prefix, optname)
@@ -278,7 +314,7 @@ func (c *completion) complete(args []string) []Completion {
 		}
 	} else if len(s.positional) > 0 {
 		// Complete for positional argument
-		ret = c.completeValue(s.positional[0].value, "", lastarg)
+		ret = c.completeValue(s.positional[0].value, s.positional[0].tag, "", lastarg)
 	} else if len(s.command.commands) > 0 {
 		// Complete for command
 		ret = c.completeCommands(s, lastarg)
@@ -301,7 +337,9 @@ func (c *completion) print(items []Completion, showDescriptions bool) {
 		for _, v := range items {
 			fmt.Printf("%s", v.Item)
 
-			if len(v.Description) > 0 {
+			if len(v.ValueName) > 0 {
+				fmt.Printf("%s  # <%s> %s", strings.Repeat(" ", maxl-len(v.Item)), v.ValueName, v.Description)
+			} else if len(v.Description) > 0 {
 				fmt.Printf("%s  # %s", strings.Repeat(" ", maxl-len(v.Item)), v.Description)
 			}
 
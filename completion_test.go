@@ -337,3 +337,96 @@ func TestParserCompletion(t *testing.T) {
 
 	os.Setenv("GO_FLAGS_COMPLETION", "")
 }
+
+func TestCompletionValueName(t *testing.T) {
+	var opts struct {
+		File    string `short:"f" long:"file" value-name:"FILE" description:"A file"`
+		Verbose bool   `short:"v" long:"verbose" value-name:"IGNORED" description:"Verbose messages"`
+	}
+
+	p := NewParser(&opts, None)
+	c := &completion{parser: p}
+
+	ret := c.complete([]string{"--"})
+	valueNames := make(map[string]string)
+
+	for _, v := range ret {
+		valueNames[v.Item] = v.ValueName
+	}
+
+	assertString(t, valueNames["--file"], "FILE")
+	assertString(t, valueNames["--verbose"], "")
+}
+
+func TestCompletionFilenameTag(t *testing.T) {
+	_, sourcefile, _, _ := runtime.Caller(0)
+	sourcedir := filepath.Dir(sourcefile)
+
+	var opts struct {
+		File string `long:"file" completion:"filename"`
+		Dir  string `long:"dir" completion:"dirname"`
+	}
+
+	p := NewParser(&opts, None)
+	c := &completion{parser: p}
+
+	items := func(ret []Completion) []string {
+		names := make([]string, len(ret))
+
+		for i, v := range ret {
+			names[i] = v.Item
+		}
+
+		return names
+	}
+
+	assertStringArray(t, items(c.complete([]string{"--file", filepath.Join(sourcedir, "completion")})), []string{
+		filepath.Join(sourcedir, "completion.go"),
+		filepath.Join(sourcedir, "completion_test.go"),
+	})
+
+	assertStringArray(t, items(c.complete([]string{"--dir", filepath.Join(sourcedir, "e")})), []string{
+		filepath.Join(sourcedir, "examples") + "/",
+	})
+}
+
+var completionTestBranches = []string{"main", "master", "release"}
+
+type completionBranch string
+
+func (b *completionBranch) Complete(match string) []Completion {
+	var ret []Completion
+
+	for _, branch := range completionTestBranches {
+		if strings.HasPrefix(branch, match) {
+			ret = append(ret, Completion{Item: branch})
+		}
+	}
+
+	return ret
+}
+
+func TestCompletionValueCompleter(t *testing.T) {
+	var opts struct {
+		Branch   completionBranch   `short:"b" long:"branch"`
+		Branches []completionBranch `long:"branches"`
+	}
+
+	p := NewParser(&opts, None)
+	c := &completion{parser: p}
+
+	items := func(ret []Completion) []string {
+		names := make([]string, len(ret))
+
+		for i, v := range ret {
+			names[i] = v.Item
+		}
+
+		return names
+	}
+
+	assertStringArray(t, items(c.complete([]string{"--branch", "ma"})), []string{"main", "master"})
+	assertStringArray(t, items(c.complete([]string{"--branch=ma"})), []string{"--branch=main", "--branch=master"})
+	assertStringArray(t, items(c.complete([]string{"-b", "r"})), []string{"release"})
+	assertStringArray(t, items(c.complete([]string{"--branches", "main", "--branches", "m"})), []string{"main", "master"})
+}
@@ -0,0 +1,175 @@
+package flags
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// WriteConfigJSON writes the current values of the options of the parser to
+// the specified writer as a JSON object. The options of each command are
+// written in an object keyed by the command name, and the options of each
+// group in an object keyed by the group name, nested as the commands and
+// groups are nested in the parser. The options of groups without a name are
+// written in the object of the enclosing group or command. Options are keyed
+// by their long name (or their short name if they do not have a long name),
+// and their values are written as JSON values of their type (values
+// implementing Marshaler, but not json.Marshaler or encoding.TextMarshaler,
+// are written as strings). An error is returned, and nothing is written, if
+// options, groups or commands of the same object share a key.
+//
+// Unless includeDefaults is true, only options which were set by the last
+// parse are written, and groups and commands without such options are
+// omitted. Function and file options, and the built-in help options, are
+// never written.
+func (p *Parser) WriteConfigJSON(writer io.Writer, includeDefaults bool) error {
+	config := newConfigObject()
+
+	if err := config.addCommand(p.Command, includeDefaults); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(config.values)
+}
+
+// configObject is a JSON object written by WriteConfigJSON. The keys of all
+// options, groups and commands belonging to the object are recorded, whether
+// they are written or not, to detect conflicting keys.
+type configObject struct {
+	values map[string]interface{}
+	owners map[string]string
+}
+
+func newConfigObject() *configObject {
+	return &configObject{
+		values: make(map[string]interface{}),
+		owners: make(map[string]string),
+	}
+}
+
+// add adds the value of key, described by owner, to the object. The value
+// is only written if write is true.
+func (o *configObject) add(key string, owner string, value interface{}, write bool) error {
+	if prev, ok := o.owners[key]; ok {
+		return newErrorf(ErrUnknown,
+			"cannot write config: %s and %s both use the key `%s'",
+			prev, owner, key)
+	}
+
+	o.owners[key] = owner
+
+	if write {
+		o.values[key] = value
+	}
+
+	return nil
+}
+
+func (o *configObject) addCommand(c *Command, includeDefaults bool) error {
+	if err := o.addGroup(c.Group, includeDefaults); err != nil {
+		return err
+	}
+
+	for _, cc := range c.commands {
+		sub := newConfigObject()
+
+		if err := sub.addCommand(cc, includeDefaults); err != nil {
+			return err
+		}
+
+		if err := o.add(cc.Name, fmt.Sprintf("command `%s'", cc.Name), sub.values, len(sub.values) != 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *configObject) addGroup(g *Group, includeDefaults bool) error {
+	for _, option := range g.options {
+		if option.isFunc() || option.isFile() {
+			continue
+		}
+
+		name := option.LongName
+
+		if name == "" {
+			name = string(option.ShortName)
+		}
+
+		write := includeDefaults || option.isSet
+
+		var value interface{}
+
+		if write {
+			var err error
+
+			if value, err = configValueJSON(option); err != nil {
+				return err
+			}
+		}
+
+		if err := o.add(name, fmt.Sprintf("flag `%s'", option), value, write); err != nil {
+			return err
+		}
+	}
+
+	for _, sg := range g.groups {
+		if sg.isBuiltinHelp {
+			continue
+		}
+
+		if sg.ShortDescription == "" {
+			if err := o.addGroup(sg, includeDefaults); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		sub := newConfigObject()
+
+		if err := sub.addGroup(sg, includeDefaults); err != nil {
+			return err
+		}
+
+		if err := o.add(sg.ShortDescription, fmt.Sprintf("group `%s'", sg.ShortDescription), sub.values, len(sub.values) != 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configValueJSON returns the value of the option to be encoded as JSON.
+func configValueJSON(option *Option) (interface{}, error) {
+	val := option.value
+	tp := val.Type()
+
+	if tp.Implements(jsonMarshalerType) || tp.Implements(textMarshalerType) ||
+		reflect.PtrTo(tp).Implements(jsonMarshalerType) || reflect.PtrTo(tp).Implements(textMarshalerType) {
+		return val.Addr().Interface(), nil
+	}
+
+	if ok, s, err := convertMarshal(val.Addr()); ok {
+		return s, err
+	}
+
+	// Write URLs as their string form instead of their fields
+	if tp == reflect.TypeOf((*url.URL)(nil)).Elem() {
+		return convertToString(val, option.tag)
+	}
+
+	return val.Interface(), nil
+}
@@ -5,7 +5,11 @@
 package flags
 
 import (
+	"flag"
 	"fmt"
+	"math"
+	"math/big"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -37,6 +41,14 @@ type ValueValidator interface {
 	IsValidValue(value string) error
 }
 
+func getTimeFormat(options multiTag) string {
+	if format := options.Get("time-format"); format != "" {
+		return format
+	}
+
+	return time.RFC3339
+}
+
 func getBase(options multiTag, base int) (int, error) {
 	sbase := options.Get("base")
 
@@ -51,6 +63,73 @@ func getBase(options multiTag, base int) (int, error) {
 	return base, err
 }
 
+// splitBasePrefix returns the digits of val and their base. Unless a base is
+// given, an explicit 0x, 0o or 0b prefix (after an optional sign) selects the
+// base and is stripped from the digits. Otherwise the base is 10, so that a
+// leading zero does not denote an octal number.
+func splitBasePrefix(val string, base int) (string, int) {
+	if base != 0 {
+		return val, base
+	}
+
+	sign, digits := "", val
+
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		sign, digits = digits[:1], digits[1:]
+	}
+
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			return sign + digits[2:], 16
+		case 'o', 'O':
+			return sign + digits[2:], 8
+		case 'b', 'B':
+			return sign + digits[2:], 2
+		}
+	}
+
+	return val, 10
+}
+
+// parseInt parses val as a signed integer in the base given by the base tag
+// or by the prefix of val (see splitBasePrefix).
+func parseInt(val string, options multiTag, bitSize int) (int64, error) {
+	base, err := getBase(options, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	digits, base := splitBasePrefix(val, base)
+	parsed, err := strconv.ParseInt(digits, base, bitSize)
+
+	if numErr, ok := err.(*strconv.NumError); ok {
+		numErr.Num = val
+	}
+
+	return parsed, err
+}
+
+// parseUint parses val as an unsigned integer in the base given by the base
+// tag or by the prefix of val (see splitBasePrefix).
+func parseUint(val string, options multiTag, bitSize int) (uint64, error) {
+	base, err := getBase(options, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	digits, base := splitBasePrefix(val, base)
+	parsed, err := strconv.ParseUint(digits, base, bitSize)
+
+	if numErr, ok := err.(*strconv.NumError); ok {
+		numErr.Num = val
+	}
+
+	return parsed, err
+}
+
 func convertMarshal(val reflect.Value) (bool, string, error) {
 	// Check first for the Marshaler interface
 	if val.IsValid() && val.Type().NumMethod() > 0 && val.CanInterface() {
@@ -60,6 +139,19 @@ func convertMarshal(val reflect.Value) (bool, string, error) {
 		}
 	}
 
+	// Then for the flag.Value interface of the standard flag package
+	if val.IsValid() && val.CanInterface() && !(val.Kind() == reflect.Ptr && val.IsNil()) {
+		if value, ok := val.Interface().(flag.Value); ok {
+			return true, value.String(), nil
+		}
+
+		if val.CanAddr() {
+			if value, ok := val.Addr().Interface().(flag.Value); ok {
+				return true, value.String(), nil
+			}
+		}
+	}
+
 	return false, "", nil
 }
 
@@ -80,6 +172,28 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 		return stringer.String(), nil
 	}
 
+	// Support for time.Time
+	if tp == reflect.TypeOf((*time.Time)(nil)).Elem() {
+		return val.Interface().(time.Time).Format(getTimeFormat(options)), nil
+	}
+
+	// Support for big.Int and big.Float
+	if tp == reflect.TypeOf((*big.Int)(nil)).Elem() {
+		v := val.Interface().(big.Int)
+		return v.String(), nil
+	}
+
+	if tp == reflect.TypeOf((*big.Float)(nil)).Elem() {
+		v := val.Interface().(big.Float)
+		return v.String(), nil
+	}
+
+	// Support for url.URL
+	if tp == reflect.TypeOf((*url.URL)(nil)).Elem() {
+		v := val.Interface().(url.URL)
+		return v.String(), nil
+	}
+
 	switch tp.Kind() {
 	case reflect.String:
 		return val.String(), nil
@@ -90,6 +204,10 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 
 		return "false", nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if units := getUnits(options); units != nil {
+			return formatUnits(val.Int() < 0, absInt(val.Int()), units), nil
+		}
+
 		base, err := getBase(options, 10)
 
 		if err != nil {
@@ -98,6 +216,10 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 
 		return strconv.FormatInt(val.Int(), base), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if units := getUnits(options); units != nil {
+			return formatUnits(false, val.Uint(), units), nil
+		}
+
 		base, err := getBase(options, 10)
 
 		if err != nil {
@@ -149,7 +271,7 @@ func convertToString(val reflect.Value, options multiTag) (string, error) {
 				return "", err
 			}
 
-			ret += keyitem + ":" + item
+			ret += keyitem + mapDelimiter(options) + item
 		}
 
 		return ret + "}", nil
@@ -176,6 +298,17 @@ func convertUnmarshal(val string, retval reflect.Value) (bool, error) {
 
 			return true, unmarshaler.UnmarshalFlag(val)
 		}
+
+		if value, ok := retval.Interface().(flag.Value); ok {
+			if retval.Kind() == reflect.Ptr && retval.IsNil() {
+				retval.Set(reflect.New(retval.Type().Elem()))
+
+				// Re-assign from the new value
+				value = retval.Interface().(flag.Value)
+			}
+
+			return true, value.Set(val)
+		}
 	}
 
 	if retval.Type().Kind() != reflect.Ptr && retval.CanAddr() {
@@ -208,6 +341,57 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 		return nil
 	}
 
+	// Support for time.Time
+	if tp == reflect.TypeOf((*time.Time)(nil)).Elem() {
+		parsed, err := time.Parse(getTimeFormat(options), val)
+
+		if err != nil {
+			return err
+		}
+
+		retval.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	// Support for big.Int and big.Float
+	if tp == reflect.TypeOf((*big.Int)(nil)).Elem() {
+		var parsed big.Int
+
+		if _, ok := parsed.SetString(val, 10); !ok {
+			return fmt.Errorf("cannot parse `%s' as an integer", val)
+		}
+
+		retval.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	if tp == reflect.TypeOf((*big.Float)(nil)).Elem() {
+		var parsed big.Float
+
+		if _, _, err := parsed.Parse(val, 10); err != nil {
+			return err
+		}
+
+		retval.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	// Support for url.URL
+	if tp == reflect.TypeOf((*url.URL)(nil)).Elem() {
+		parsed, err := url.Parse(val)
+
+		if err != nil {
+			return err
+		}
+
+		if !isStringFalsy(options.Get("url-require-scheme")) && !parsed.IsAbs() {
+			return fmt.Errorf("url `%s' does not have a scheme", val)
+		}
+
+		retval.Set(reflect.ValueOf(*parsed))
+		return nil
+	}
+
 	switch tp.Kind() {
 	case reflect.String:
 		retval.SetString(val)
@@ -215,7 +399,7 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 		if val == "" {
 			retval.SetBool(true)
 		} else {
-			b, err := strconv.ParseBool(val)
+			b, err := parseBool(val)
 
 			if err != nil {
 				return err
@@ -224,13 +408,11 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 			retval.SetBool(b)
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		base, err := getBase(options, 10)
-
-		if err != nil {
-			return err
+		if units := getUnits(options); units != nil {
+			return parseUnits(val, retval, units)
 		}
 
-		parsed, err := strconv.ParseInt(val, base, tp.Bits())
+		parsed, err := parseInt(val, options, tp.Bits())
 
 		if err != nil {
 			return err
@@ -238,13 +420,11 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 
 		retval.SetInt(parsed)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		base, err := getBase(options, 10)
-
-		if err != nil {
-			return err
+		if units := getUnits(options); units != nil {
+			return parseUnits(val, retval, units)
 		}
 
-		parsed, err := strconv.ParseUint(val, base, tp.Bits())
+		parsed, err := parseUint(val, options, tp.Bits())
 
 		if err != nil {
 			return err
@@ -261,17 +441,24 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 		retval.SetFloat(parsed)
 	case reflect.Slice:
 		elemtp := tp.Elem()
+		items := []string{val}
 
-		elemvalptr := reflect.New(elemtp)
-		elemval := reflect.Indirect(elemvalptr)
-
-		if err := convert(val, elemval, options); err != nil {
-			return err
+		if sep := options.Get("sep"); sep != "" {
+			items = strings.Split(val, sep)
 		}
 
-		retval.Set(reflect.Append(retval, elemval))
+		for _, item := range items {
+			elemvalptr := reflect.New(elemtp)
+			elemval := reflect.Indirect(elemvalptr)
+
+			if err := convert(item, elemval, options); err != nil {
+				return err
+			}
+
+			retval.Set(reflect.Append(retval, elemval))
+		}
 	case reflect.Map:
-		parts := strings.SplitN(val, ":", 2)
+		parts := strings.SplitN(val, mapDelimiter(options), 2)
 
 		key := parts[0]
 		var value string
@@ -314,6 +501,22 @@ func convert(val string, retval reflect.Value, options multiTag) error {
 	return nil
 }
 
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+
+	return strconv.ParseBool(val)
+}
+
+func isBoolValue(val string) bool {
+	_, err := parseBool(val)
+	return err == nil
+}
+
 func isPrint(s string) bool {
 	for _, c := range s {
 		if !strconv.IsPrint(c) {
@@ -324,6 +527,183 @@ func isPrint(s string) bool {
 	return true
 }
 
+// mapDelimiter returns the separator between the keys and values of map
+// options, as given by the map-delim tag.
+func mapDelimiter(options multiTag) string {
+	if delim := options.Get("map-delim"); delim != "" {
+		return delim
+	}
+
+	return ":"
+}
+
+// unit is a suffix of a number given with the units tag, multiplying the
+// number by factor.
+type unit struct {
+	suffix string
+	factor uint64
+}
+
+// byteUnits are the units of the bytes units tag, ordered by decreasing
+// factor. The binary units are listed before the decimal units of the same
+// magnitude.
+var byteUnits = []unit{
+	{"EiB", 1 << 60}, {"EB", 1e18},
+	{"PiB", 1 << 50}, {"PB", 1e15},
+	{"TiB", 1 << 40}, {"TB", 1e12},
+	{"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6},
+	{"KiB", 1 << 10}, {"KB", 1e3},
+	{"B", 1},
+}
+
+// siUnits are the units of the si units tag, ordered by decreasing factor.
+var siUnits = []unit{
+	{"E", 1e18},
+	{"P", 1e15},
+	{"T", 1e12},
+	{"G", 1e9},
+	{"M", 1e6},
+	{"k", 1e3},
+}
+
+// getUnits returns the units given by the units tag, or nil if there is no
+// (valid) units tag.
+func getUnits(options multiTag) []unit {
+	switch options.Get("units") {
+	case "bytes":
+		return byteUnits
+	case "si":
+		return siUnits
+	}
+
+	return nil
+}
+
+// parseUnits converts val, a number optionally followed by one of units, to
+// the integer retval.
+func parseUnits(val string, retval reflect.Value, units []unit) error {
+	i := strings.IndexFunc(val, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '-' && r != '+'
+	})
+
+	if i < 0 {
+		i = len(val)
+	}
+
+	number, suffix := val[:i], strings.TrimSpace(val[i:])
+	factor := uint64(1)
+
+	if len(suffix) > 1 && suffix[0] == '.' && suffix[1] >= '0' && suffix[1] <= '9' {
+		return fmt.Errorf("fractional values are not supported in `%s'", val)
+	}
+
+	if suffix != "" {
+		found := false
+
+		for _, u := range units {
+			// Accept e.g. kb and K for KB
+			if strings.EqualFold(suffix, u.suffix) || (u.suffix != "B" && strings.EqualFold(suffix, strings.TrimSuffix(u.suffix, "B"))) {
+				factor = u.factor
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown unit `%s' in `%s'", suffix, val)
+		}
+	}
+
+	// Allow a single sign, ParseUint rejects any further ones
+	negative := strings.HasPrefix(number, "-")
+	digits := number
+
+	if negative || strings.HasPrefix(number, "+") {
+		digits = number[1:]
+	}
+
+	parsed, err := strconv.ParseUint(digits, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("invalid number `%s' in `%s'", number, val)
+	}
+
+	if parsed > math.MaxUint64/factor {
+		return fmt.Errorf("value `%s' out of range", val)
+	}
+
+	parsed *= factor
+
+	switch retval.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// The magnitude of the smallest negative value is MaxInt64+1
+		limit := uint64(math.MaxInt64)
+
+		if negative {
+			limit++
+		}
+
+		if parsed > limit {
+			return fmt.Errorf("value `%s' out of range", val)
+		}
+
+		n := int64(parsed)
+
+		if negative {
+			n = -n
+		}
+
+		if retval.OverflowInt(n) {
+			return fmt.Errorf("value `%s' out of range", val)
+		}
+
+		retval.SetInt(n)
+	default:
+		if negative && parsed != 0 {
+			return fmt.Errorf("value `%s' out of range", val)
+		}
+
+		if retval.OverflowUint(parsed) {
+			return fmt.Errorf("value `%s' out of range", val)
+		}
+
+		retval.SetUint(parsed)
+	}
+
+	return nil
+}
+
+// formatUnits formats the absolute value v using the largest of units by
+// which it is divisible.
+func formatUnits(negative bool, v uint64, units []unit) string {
+	ret := strconv.FormatUint(v, 10)
+
+	if v != 0 {
+		for _, u := range units {
+			if v%u.factor == 0 {
+				ret = strconv.FormatUint(v/u.factor, 10) + u.suffix
+				break
+			}
+		}
+	}
+
+	if negative {
+		ret = "-" + ret
+	}
+
+	return ret
+}
+
+// absInt returns the absolute value of v as an unsigned integer.
+func absInt(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+
+	return uint64(v)
+}
+
 func quoteIfNeeded(s string) string {
 	if !isPrint(s) {
 		return strconv.Quote(s)
@@ -1,6 +1,10 @@
 package flags
 
 import (
+	"math"
+	"math/big"
+	"net/url"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -157,3 +161,334 @@ func TestConvertToStringInvalidUintBase(t *testing.T) {
 
 	assertError(t, err, ErrMarshal, "strconv.ParseInt: parsing \"no\": invalid syntax")
 }
+
+func TestConvertIntPrefix(t *testing.T) {
+	var opts = struct {
+		Int    int     `long:"int"`
+		Uint   uint32  `long:"uint"`
+		Slice  []int64 `long:"slice"`
+		Base10 int     `long:"base10" base:"10"`
+	}{}
+
+	p := NewNamedParser("test", None)
+	p.AddGroup("test group", "", &opts)
+
+	_, err := p.ParseArgs([]string{
+		"--int", "0x1F",
+		"--uint", "0o755",
+		"--slice", "0b1010", "--slice", "0755", "--slice", "-0x10", "--slice", "+0o17",
+		"--base10", "010",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Int != 31 {
+		t.Errorf("Expected Int to be 31, but got %v", opts.Int)
+	}
+
+	if opts.Uint != 493 {
+		t.Errorf("Expected Uint to be 493, but got %v", opts.Uint)
+	}
+
+	if !reflect.DeepEqual(opts.Slice, []int64{10, 755, -16, 15}) {
+		t.Errorf("Expected Slice to be [10 755 -16 15], but got %v", opts.Slice)
+	}
+
+	if opts.Base10 != 10 {
+		t.Errorf("Expected Base10 to be 10, but got %v", opts.Base10)
+	}
+}
+
+func TestConvertIntInvalidPrefix(t *testing.T) {
+	var opts = struct {
+		Int int `long:"int"`
+	}{}
+
+	p := NewNamedParser("test", None)
+	p.AddGroup("test group", "", &opts)
+
+	_, err := p.ParseArgs([]string{"--int", "0x1G"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"int' (expected int): strconv.ParseInt: parsing \"0x1G\": invalid syntax")
+
+	_, err = p.ParseArgs([]string{"--int", "1_000"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"int' (expected int): strconv.ParseInt: parsing \"1_000\": invalid syntax")
+}
+
+func TestConvertIntLeadingZero(t *testing.T) {
+	var opts = struct {
+		Int  int    `long:"int"`
+		Uint uint16 `long:"uint"`
+	}{}
+
+	p := NewNamedParser("test", None)
+	p.AddGroup("test group", "", &opts)
+
+	if _, err := p.ParseArgs([]string{"--int", "010", "--uint", "08"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Int != 10 {
+		t.Errorf("Expected Int to be 10, but got %v", opts.Int)
+	}
+
+	if opts.Uint != 8 {
+		t.Errorf("Expected Uint to be 8, but got %v", opts.Uint)
+	}
+}
+
+func TestConvertTime(t *testing.T) {
+	var opts = struct {
+		Since  time.Time   `long:"since" time-format:"2006-01-02"`
+		Until  time.Time   `long:"until"`
+		Dates  []time.Time `long:"date" time-format:"2006-01-02"`
+		Format time.Time   `long:"format" time-format:"02/01/2006"`
+	}{
+		Format: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+
+	p := NewNamedParser("test", None)
+	grp, _ := p.AddGroup("test group", "", &opts)
+
+	_, err := p.ParseArgs([]string{
+		"--since", "2024-01-02",
+		"--until", "2024-01-02T15:04:05Z",
+		"--date", "2024-02-01", "--date", "2024-02-02",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Since.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected since: %v", opts.Since)
+	}
+
+	if !opts.Until.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("Unexpected until: %v", opts.Until)
+	}
+
+	if len(opts.Dates) != 2 || !opts.Dates[1].Equal(time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected dates: %v", opts.Dates)
+	}
+
+	expectConvert(t, grp.Options()[0], "2024-01-02")
+	expectConvert(t, grp.Options()[1], "2024-01-02T15:04:05Z")
+	expectConvert(t, grp.Options()[3], "04/03/2024")
+	assertString(t, grp.Options()[3].defaultLiteral, "04/03/2024")
+
+	_, err = p.ParseArgs([]string{"--since", "yesterday"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"since' (expected time.Time): parsing time \"yesterday\" as \"2006-01-02\": cannot parse \"yesterday\" as \"2006\"")
+}
+
+func TestConvertBig(t *testing.T) {
+	var opts = struct {
+		Limit  *big.Int    `long:"limit"`
+		Limits []*big.Int  `long:"limits"`
+		Ratio  *big.Float  `long:"ratio"`
+		Value  big.Int     `long:"value"`
+		Floats []big.Float `long:"float"`
+	}{}
+
+	p := NewNamedParser("test", None)
+	grp, _ := p.AddGroup("test group", "", &opts)
+
+	_, err := p.ParseArgs([]string{
+		"--limit", "123456789012345678901234567890",
+		"--limits", "1", "--limits=-2",
+		"--ratio", "1.5",
+		"--value", "42",
+		"--float", "0.25",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Limit == nil || opts.Limit.String() != "123456789012345678901234567890" {
+		t.Errorf("Unexpected limit: %v", opts.Limit)
+	}
+
+	if len(opts.Limits) != 2 || opts.Limits[1].Int64() != -2 {
+		t.Errorf("Unexpected limits: %v", opts.Limits)
+	}
+
+	if opts.Ratio == nil || opts.Ratio.String() != "1.5" {
+		t.Errorf("Unexpected ratio: %v", opts.Ratio)
+	}
+
+	expectConvert(t, grp.Options()[0], "123456789012345678901234567890")
+	expectConvert(t, grp.Options()[1], "[1, -2]")
+	expectConvert(t, grp.Options()[2], "1.5")
+	expectConvert(t, grp.Options()[3], "42")
+	expectConvert(t, grp.Options()[4], "[0.25]")
+
+	_, err = p.ParseArgs([]string{"--limit", "0x10"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"limit' (expected *big.Int): cannot parse `0x10' as an integer")
+
+	_, err = p.ParseArgs([]string{"--ratio", "abc"})
+
+	if err == nil || !IsMarshal(err) {
+		t.Errorf("Expected marshal error, but got %v", err)
+	}
+}
+
+func TestConvertURL(t *testing.T) {
+	var opts = struct {
+		API      *url.URL   `long:"api"`
+		Endpoint url.URL    `long:"endpoint"`
+		Mirrors  []*url.URL `long:"mirror"`
+		Absolute *url.URL   `long:"absolute" url-require-scheme:"yes"`
+	}{}
+
+	opts.API = &url.URL{Scheme: "https", Host: "example.com", Path: "/api"}
+
+	p := NewNamedParser("test", None)
+	grp, _ := p.AddGroup("test group", "", &opts)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, grp.Options()[0].defaultLiteral, "https://example.com/api")
+
+	_, err := p.ParseArgs([]string{
+		"--api", "https://x/y",
+		"--endpoint", "relative/path",
+		"--mirror", "http://a", "--mirror", "http://b/c?d=e",
+		"--absolute", "ftp://host/file",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.API.Host, "x")
+	assertString(t, opts.API.Path, "/y")
+	assertString(t, opts.Endpoint.Path, "relative/path")
+	assertString(t, opts.Absolute.Scheme, "ftp")
+
+	if len(opts.Mirrors) != 2 || opts.Mirrors[1].RawQuery != "d=e" {
+		t.Errorf("Unexpected mirrors: %v", opts.Mirrors)
+	}
+
+	expectConvert(t, grp.Options()[0], "https://x/y")
+	expectConvert(t, grp.Options()[1], "relative/path")
+	expectConvert(t, grp.Options()[2], "[http://a, http://b/c?d=e]")
+
+	_, err = p.ParseArgs([]string{"--api", "http://[::1"})
+
+	if err == nil || !IsMarshal(err) {
+		t.Errorf("Expected marshal error, but got %v", err)
+	}
+
+	_, err = p.ParseArgs([]string{"--absolute", "host/file"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"absolute' (expected *url.URL): url `host/file' does not have a scheme")
+}
+
+func TestConvertUnits(t *testing.T) {
+	var opts = struct {
+		MaxSize int64   `long:"max-size" units:"bytes"`
+		Limit   uint32  `long:"limit" units:"si"`
+		Sizes   []int   `long:"size" units:"bytes"`
+		Small   int8    `long:"small" units:"bytes"`
+		Offset  int     `long:"offset" units:"bytes"`
+		Plain   int64   `long:"plain"`
+		Count   *uint64 `long:"count" units:"si"`
+	}{}
+
+	opts.MaxSize = 10 << 20
+
+	p := NewNamedParser("test", None)
+	grp, _ := p.AddGroup("test group", "", &opts)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, grp.Options()[0].defaultLiteral, "10MiB")
+
+	_, err := p.ParseArgs([]string{
+		"--max-size", "10MB",
+		"--limit", "2k",
+		"--size", "1KiB", "--size", "512", "--size", "3 gb",
+		"--offset", "-4K",
+		"--count", "3M",
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.MaxSize != 10000000 || opts.Limit != 2000 || opts.Offset != -4000 || *opts.Count != 3000000 {
+		t.Errorf("Unexpected values: %+v", opts)
+	}
+
+	if len(opts.Sizes) != 3 || opts.Sizes[0] != 1024 || opts.Sizes[1] != 512 || opts.Sizes[2] != 3000000000 {
+		t.Errorf("Unexpected sizes: %v", opts.Sizes)
+	}
+
+	expectConvert(t, grp.Options()[0], "10MB")
+	expectConvert(t, grp.Options()[1], "2k")
+	expectConvert(t, grp.Options()[2], "[1KiB, 512B, 3GB]")
+	expectConvert(t, grp.Options()[4], "-4KB")
+
+	opts.MaxSize = 1500
+	expectConvert(t, grp.Options()[0], "1500B")
+
+	for arg, expected := range map[string]int64{
+		"-9223372036854775808": math.MinInt64,
+		"9223372036854775807":  math.MaxInt64,
+		"+5KB":                 5000,
+		"-8EiB":                math.MinInt64,
+	} {
+		if _, err := p.ParseArgs([]string{"--max-size=" + arg}); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", arg, err)
+		}
+
+		if opts.MaxSize != expected {
+			t.Errorf("Expected %s to be %d, but got %d", arg, expected, opts.MaxSize)
+		}
+	}
+
+	opts.Limit = 1500
+	expectConvert(t, grp.Options()[1], "1500")
+
+	for _, tc := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{"--max-size", "10XB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "max-size' (expected int64): unknown unit `XB' in `10XB'"},
+		{[]string{"--max-size", "MB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "max-size' (expected int64): invalid number `' in `MB'"},
+		{[]string{"--small", "1KB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "small' (expected int8): value `1KB' out of range"},
+		{[]string{"--limit", "5G"}, "invalid argument for flag `" + defaultLongOptDelimiter + "limit' (expected uint32): value `5G' out of range"},
+		{[]string{"--offset=--5"}, "invalid argument for flag `" + defaultLongOptDelimiter + "offset' (expected int): invalid number `--5' in `--5'"},
+		{[]string{"--offset=+-5KB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "offset' (expected int): invalid number `+-5' in `+-5KB'"},
+		{[]string{"--max-size", "1.5GB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "max-size' (expected int64): fractional values are not supported in `1.5GB'"},
+		{[]string{"--max-size=-9223372036854775809"}, "invalid argument for flag `" + defaultLongOptDelimiter + "max-size' (expected int64): value `-9223372036854775809' out of range"},
+		{[]string{"--plain", "1KB"}, "invalid argument for flag `" + defaultLongOptDelimiter + "plain' (expected int64): strconv.ParseInt: parsing \"1KB\": invalid syntax"},
+	} {
+		_, err := p.ParseArgs(tc.args)
+		assertError(t, err, ErrMarshal, tc.msg)
+	}
+}
+
+func TestConvertUnitsInvalid(t *testing.T) {
+	var invalid = struct {
+		Size int64 `long:"size" units:"metric"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "invalid units `metric' for flag `size'", &invalid)
+
+	var notInteger = struct {
+		Size string `long:"size" units:"bytes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "units flag `size' must be an integer", &notInteger)
+}
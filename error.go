@@ -58,6 +58,26 @@ const (
 
 	// ErrInvalidTag indicates an invalid tag or invalid use of an existing tag
 	ErrInvalidTag
+
+	// ErrExperimental indicates that an experimental option was used while
+	// experimental options are not allowed.
+	ErrExperimental
+
+	// ErrVersion indicates that the built-in version flag was specified. The
+	// error message contains the version (see Parser.Version).
+	ErrVersion
+
+	// ErrDuplicatedCommand indicates that a command name or alias has been
+	// used by more than one command with the same parent.
+	ErrDuplicatedCommand
+
+	// ErrTooMany indicates that a flag was specified more often than allowed
+	// by its max tag.
+	ErrTooMany
+
+	// ErrAmbiguousFlag indicates that an abbreviated long flag matched more
+	// than one flag (see the AllowPrefixMatch option).
+	ErrAmbiguousFlag
 )
 
 func (e ErrorType) String() string {
@@ -92,6 +112,16 @@ func (e ErrorType) String() string {
 		return "invalid choice"
 	case ErrInvalidTag:
 		return "invalid tag"
+	case ErrExperimental:
+		return "experimental"
+	case ErrVersion:
+		return "version"
+	case ErrDuplicatedCommand:
+		return "duplicated command"
+	case ErrTooMany:
+		return "too many"
+	case ErrAmbiguousFlag:
+		return "ambiguous flag"
 	}
 
 	return "unrecognized error type"
@@ -136,3 +166,29 @@ func wrapError(err error) *Error {
 
 	return ret
 }
+
+func isErrorType(err error, tp ErrorType) bool {
+	flagError, ok := err.(*Error)
+
+	return ok && flagError != nil && flagError.Type == tp
+}
+
+// IsUnknownFlag returns true if err is an error of type ErrUnknownFlag.
+func IsUnknownFlag(err error) bool {
+	return isErrorType(err, ErrUnknownFlag)
+}
+
+// IsRequired returns true if err is an error of type ErrRequired.
+func IsRequired(err error) bool {
+	return isErrorType(err, ErrRequired)
+}
+
+// IsMarshal returns true if err is an error of type ErrMarshal.
+func IsMarshal(err error) bool {
+	return isErrorType(err, ErrMarshal)
+}
+
+// IsUnknownCommand returns true if err is an error of type ErrUnknownCommand.
+func IsUnknownCommand(err error) bool {
+	return isErrorType(err, ErrUnknownCommand)
+}
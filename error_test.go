@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorTypeHelpers(t *testing.T) {
+	var nilError *Error
+
+	helpers := map[ErrorType]func(error) bool{
+		ErrUnknownFlag:    IsUnknownFlag,
+		ErrRequired:       IsRequired,
+		ErrMarshal:        IsMarshal,
+		ErrUnknownCommand: IsUnknownCommand,
+	}
+
+	for tp, helper := range helpers {
+		t.Run(tp.String(), func(t *testing.T) {
+			if !helper(newError(tp, "an error")) {
+				t.Errorf("Expected true for an error of type %s", tp)
+			}
+
+			if helper(newError(ErrHelp, "an error")) {
+				t.Errorf("Expected false for an error of type %s", ErrHelp)
+			}
+
+			if helper(nil) {
+				t.Errorf("Expected false for no error")
+			}
+
+			if helper(nilError) {
+				t.Errorf("Expected false for a nil *Error")
+			}
+
+			if helper(errors.New("an error")) {
+				t.Errorf("Expected false for a plain error")
+			}
+		})
+	}
+}
+
+func TestErrorTypeHelpersParse(t *testing.T) {
+	var opts struct {
+		Value int `long:"value"`
+	}
+
+	_, err := NewParser(&opts, None).ParseArgs([]string{"--unknown"})
+
+	if !IsUnknownFlag(err) {
+		t.Errorf("Expected unknown flag error, but got %v", err)
+	}
+
+	_, err = NewParser(&opts, None).ParseArgs([]string{"--value", "x"})
+
+	if !IsMarshal(err) {
+		t.Errorf("Expected marshal error, but got %v", err)
+	}
+}
+
+func TestErrorFormatter(t *testing.T) {
+	var opts = struct {
+		Name string `long:"name"`
+	}{}
+
+	messages := map[ErrorType]string{
+		ErrUnknownFlag: "unbekannte Option",
+	}
+
+	p := NewParser(&opts, None)
+	p.ErrorFormatter = func(err *Error) string {
+		if msg, ok := messages[err.Type]; ok {
+			return msg
+		}
+
+		return err.Message
+	}
+
+	_, err := p.ParseArgs([]string{"--unknown"})
+	assertError(t, err, ErrUnknownFlag, "unbekannte Option")
+
+	_, err = p.ParseArgs([]string{"--name"})
+	assertError(t, err, ErrExpectedArgument, "expected argument for flag `"+defaultLongOptDelimiter+"name'")
+}
@@ -67,9 +67,19 @@ line, you specify the value for such an option as key:value. For example
 Then, the AuthorInfo map can be filled with something like
 -a name:Jesse -a "surname:van den Kieboom".
 
+Function options are called while parsing, once for every occurrence of
+the option, in the order in which the options appear on the command line.
+The function may take the option argument as its only parameter and may
+return an error. The first error returned by a function stops parsing and is
+returned by the parser as an ErrMarshal error.
+
 Finally, for full control over the conversion between command line argument
 values and options, user defined types can choose to implement the Marshaler
-and Unmarshaler interfaces.
+and Unmarshaler interfaces. Types implementing the flag.Value interface of the
+standard flag package are supported as well: Set is called to convert an
+argument (once for every element of a slice) and String is used to show the
+default value in the help. Marshaler and Unmarshaler take precedence over
+flag.Value.
 
 
 Available field tags
@@ -77,11 +87,21 @@ Available field tags
 The following is a list of tags for struct fields supported by go-flags:
 
     short:            the short name of the option (single character)
+    short-aliases:    an additional short name of the option (single character).
+                      Only the short name is shown in the help. This tag can be
+                      specified multiple times for several aliases (optional)
     long:             the long name of the option
     required:         if non empty, makes the option required to appear on the command
                       line. If a required option is not present, the parser will
                       return ErrRequired (optional)
-    description:      the description of the option (optional)
+    description:      the description of the option. The description is
+                      wrapped in the help, except for lines starting with a
+                      tab, which are kept as they are (with the tab replaced
+                      by an indentation) to allow for small pre-formatted
+                      examples or tables (optional)
+    summary:          a short summary of the option, shown in the help instead
+                      of the description when the parser's CompactHelp is set
+                      (optional)
     long-description: the long description of the option. Currently only
                       displayed in generated man pages (optional)
     no-flag:          if non-empty, this field is ignored as an option (optional)
@@ -91,15 +111,28 @@ The following is a list of tags for struct fields supported by go-flags:
                     --option=argument (optional)
     optional-value: the value of an optional option when the option occurs
                     without an argument. This tag can be specified multiple
-                    times in the case of maps or slices (optional)
+                    times in the case of maps or slices. Specifying an
+                    optional-value makes the argument optional, unless the
+                    optional tag is explicitly set to a false value, so
+                    --color sets the optional-value and --color=never sets
+                    never. A following argument is never consumed as the
+                    value. When bundled with short options (e.g. -fc), the
+                    option gets its optional-value, unless it comes first
+                    and the rest is taken as its argument (e.g. -cnever)
+                    (optional)
     default:        the default value of an option. This tag can be specified
-                    multiple times in the case of slices or maps (optional)
+                    multiple times in the case of slices or maps. An empty
+                    value (default:"") declares the empty string as the
+                    default, which is shown as "" in the help, unlike an
+                    option without a default tag (see Option.HasDefault)
+                    (optional)
     default-mask:   when specified, this value will be displayed in the help
                     instead of the actual default value. This is useful
                     mostly for hiding otherwise sensitive information from
                     showing up in the help. If default-mask takes the special
-                    value "-", then no default value will be shown at all
-                    (optional)
+                    value "-", then no default value will be shown at all.
+                    The default-mask takes precedence over the parser's
+                    MaskDefaults setting (optional)
     env:            the default value of the option is overridden from the
                     specified environment variable, if one has been defined.
                     (optional)
@@ -108,13 +141,109 @@ The following is a list of tags for struct fields supported by go-flags:
                     slices and maps (optional)
     value-name:     the name of the argument value (to be shown in the help)
                     (optional)
+    completion:     the kind of completion to provide for the value of the
+                    option or positional argument. Either "filename" to
+                    complete existing files or "dirname" to complete
+                    existing directories (optional)
     choice:         limits the values for an option to a set of values.
                     Repeat this tag once for each allowable value.
                     e.g. `long:"animal" choice:"cat" choice:"dog"`
+                    For integer options, a choice can also be an inclusive
+                    range of the form min..max, e.g. `choice:"1..5"`, which
+                    is shown as 1-5 in the help. Ranges and single values
+                    can be combined
     hidden:         if non-empty, the option is not visible in the help or man page.
-
-    base: a base (radix) used to convert strings to integer values, the
-          default base is 10 (i.e. decimal) (optional)
+    experimental:   if non-empty, the option can only be used when the parser's
+                    AllowExperimental is set. Otherwise the option is hidden
+                    and using it results in an ErrExperimental error. When
+                    allowed, the option is marked as (experimental) in the
+                    help (optional)
+    os:             a comma separated list of operating systems (as reported by
+                    runtime.GOOS, e.g. os:"linux,darwin") on which the option
+                    is available. On other systems the option is hidden
+                    from the help, man page and completion, and using it
+                    results in an ErrUnknownFlag error (optional)
+    counter:        if non-empty on an integer field, the option takes no
+                    argument and each occurrence increments the field by
+                    one, e.g. -vvv sets it to 3 (optional)
+    abs-path:       if non-empty on a string or string slice option, relative
+                    paths given as the value are made absolute (see
+                    filepath.Abs) before they are stored. Empty values are
+                    kept as they are (optional)
+    min:            the minimum number of values of a slice option given on the
+                    command line. Fewer values result in an ErrRequired
+                    error. Values not given on the command line, such as
+                    defaults, are not counted (optional)
+    max:            the maximum number of values of a slice option given on the
+                    command line. More values result in an ErrTooMany
+                    error (optional)
+    clearable:      if non-empty on a slice or map option, an empty value
+                    given with an equal sign (e.g. --list=) clears the
+                    option to an empty, non-nil, slice or map instead of
+                    adding an empty value (optional)
+    append-operator: if non-empty on a slice or map option, a value given
+                    with += (e.g. --list+=value) is added to the current
+                    values of the option, including values set before
+                    parsing, while a value given in any other way (e.g.
+                    --list=value) replaces all of its values. Using the tag
+                    on any other type of option results in an
+                    ErrInvalidTag error (optional)
+    setter:         if non-empty on a struct field, the option takes arguments
+                    of the form path=value, where path is a dot separated list
+                    of (case insensitive) field names in the struct, e.g.
+                    --set server.port=8080. Unknown paths result in an
+                    ErrMarshal error (optional)
+    greedy:         if non-empty on a slice option, the option consumes all
+                    following arguments as values until the next argument
+                    that starts with a dash (e.g. --include a b c). A double
+                    dash also ends the values, and a value given as
+                    --include=a is never followed by more. The consumed
+                    arguments are not treated as positional arguments, so
+                    greedy options take precedence over PassAfterNonOption
+                    (optional)
+    time-format:    the layout used to convert strings to time.Time values, as
+                    accepted by time.Parse. The default layout is
+                    time.RFC3339 (optional)
+    map-delim:      the separator between the key and the value of the
+                    arguments of a map option (e.g. --env=key=value for
+                    map-delim:"="). The default separator is ":". Unless a
+                    value-name is given, the help shows key<sep>value as the
+                    value name (optional)
+    sep:            the separator used to split each argument of a slice
+                    option into multiple elements (e.g. --list=a,b,c for
+                    sep:","). Repeating the option still appends to the
+                    slice. Without a separator, each argument is a single
+                    element (optional)
+    units:          the units accepted as a suffix of the arguments of an
+                    integer option: "bytes" for byte sizes (e.g. 10MB,
+                    with KB, MB, GB, TB, PB and EB as powers of 1000 and
+                    KiB, MiB, GiB, TiB, PiB and EiB as powers of 1024) or
+                    "si" for SI prefixes (e.g. 2k, with k, M, G, T, P and
+                    E). Unknown units result in an ErrMarshal error, and
+                    default values are shown in the help using the largest
+                    unit by which they are divisible (optional)
+    url-require-scheme: if non-empty on a url.URL option, relative URLs
+                    (without a scheme) result in an ErrMarshal error
+                    (optional)
+    open-mode:      the mode used to open the file given as the argument of
+                    an option of type *os.File, io.Reader or io.Writer. One
+                    of "read", "write" (create or truncate), "append" or
+                    "readwrite". Defaults to "write" for io.Writer and
+                    "read" otherwise. The path "-" refers to stdout when
+                    writing and to stdin when reading. Opened files are
+                    available from Parser.OpenedFiles and must be closed
+                    by the caller (optional)
+    allow-dash-value: if non-empty, the argument following the option is
+                    always used as its value, even if it starts with a dash
+                    (e.g. --pattern -v). Without this tag such an argument
+                    is treated as an option, and the value must be given
+                    as --pattern=-v instead (optional)
+
+    base: a base (radix) used to convert strings to integer values. When
+          no base is given, the base is implied by the prefix of the value:
+          0x for hexadecimal, 0o for octal, 0b for binary and decimal
+          otherwise (a leading zero alone does not make a value octal). Integers are always shown in decimal in the help
+          unless a base is given (optional)
 
     ini-name:       the explicit ini option name (optional)
     no-ini:         if non-empty this field is ignored as an ini option
@@ -126,6 +255,10 @@ The following is a list of tags for struct fields supported by go-flags:
                           gets prepended to every option's long name and
                           subgroup's namespace of this group, separated by
                           the parser's namespace delimiter (optional)
+    help-priority:        when specified on a group struct field, sets the
+                          priority of the group in the help and man page.
+                          Groups with a lower priority are shown first
+                          (optional)
     env-namespace:        when specified on a group struct field, the env-namespace
                           gets prepended to every option's env key and
                           subgroup's env-namespace of this group, separated by
@@ -134,6 +267,18 @@ The following is a list of tags for struct fields supported by go-flags:
                           field a (sub)command with the given name (optional)
     subcommands-optional: when specified on a command struct field, makes
                           any subcommands of that command optional (optional)
+    subcommands-required: when specified on a command struct field, makes
+                          a subcommand of that command required, even if
+                          subcommands are made optional otherwise (optional)
+    hide-subcommands:     when specified on a command struct field, hides
+                          all subcommands of the command (and their
+                          descendants) from the help, man page and
+                          completion. The subcommands can still be invoked
+                          (optional)
+    category:             when specified on a command struct field, lists the
+                          command under the given category heading in the
+                          help and man page instead of under the default
+                          "Available commands" heading (optional)
     alias:                when specified on a command struct field, adds the
                           specified name as an alias for the command. Can be
                           be specified multiple times to add more than one
@@ -151,14 +296,33 @@ The following is a list of tags for struct fields supported by go-flags:
                           arguments. If the "required" tag is set on the
                           rest arguments slice, then its value determines
                           the minimum amount of rest arguments that needs to
-                          be provided (e.g. `required:"2"`) (optional)
+                          be provided (e.g. `required:"2"`). The
+                          "description" tag on the field is shown below the
+                          arguments heading in the help (optional)
+    passthrough:          when specified on a []string field, all arguments
+                          after a double dash (--), or the ArgsTerminator of
+                          the parser, are assigned to the field instead of
+                          being returned as remaining arguments.
+                          The field of the innermost active command takes
+                          precedence (optional)
     positional-arg-name:  used on a field in a positional argument struct; name
                           of the positional argument placeholder to be shown in
                           the help (optional)
+    positional-rest:      used on a slice field in a positional argument struct
+                          to explicitly mark it as receiving all arguments
+                          remaining after the preceding positional arguments
+                          have been filled, e.g. repeated key value pairs.
+                          The field must be the last field of the struct.
+                          Like any rest argument it can be named with
+                          positional-arg-name, described with description
+                          and given a minimum count with required (optional)
 
 Either the `short:` tag or the `long:` must be specified to make the field eligible as an
 option.
 
+Unknown tags and invalid tag values are ignored by the parser. Use
+Parser.ValidateTags to report them, e.g. to catch misspelled tags in a test.
+
 
 Option groups
 
@@ -174,6 +338,10 @@ There are currently three ways to specify option groups.
     3. Add a struct field to the top-level options annotated with the
        group:"group-name" tag.
 
+Struct fields without the group tag, including embedded structs, do not
+create a group. Their options are merged into the enclosing group instead.
+An embedded struct used as a group must be exported.
+
 
 
 Commands
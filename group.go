@@ -7,7 +7,10 @@ package flags
 import (
 	"errors"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -16,6 +19,38 @@ import (
 // for options.
 var ErrNotPointerToStruct = errors.New("provided data is not a pointer to struct")
 
+// Defaulter is the interface implemented by option structs (of groups and
+// commands) which compute their defaults in code. SetDefaults is called at
+// the start of every parse, before any command line arguments are applied, and
+// for lazily added commands when the command is first used. Fields set by
+// SetDefaults act as default values: the options are not marked as set and
+// their values are shown as the default in the help, taking precedence over
+// the default tag.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// AfterParser is the interface implemented by option structs (of groups and
+// commands) which need to validate or normalize their values once parsing
+// has succeeded. AfterParse is called for the groups of the parser and of
+// each active command, from the parser down to the innermost command, after
+// all arguments have been parsed and before the command is executed (or the
+// CommandHandler is called). An error returned by AfterParse aborts the
+// parse and is reported as an ErrMarshal error, unless it is an *Error.
+type AfterParser interface {
+	AfterParse() error
+}
+
+// DescriptionProvider is the interface implemented by option structs (of
+// groups and commands) which provide the descriptions of their options at
+// runtime, e.g. to localize them. OptionDescription is called with the long
+// name of an option (without namespace, empty for options with only a short
+// name) when the help, man page or completions are rendered. If it returns
+// false, the description tag of the option is used.
+type DescriptionProvider interface {
+	OptionDescription(longName string) (string, bool)
+}
+
 // Group represents an option group. Option groups can be used to logically
 // group options together under a description. Groups are only used to provide
 // more structure to options both for the user (as displayed in the help message)
@@ -31,15 +66,24 @@ type Group struct {
 	// (Command embeds Group) in the built-in generated help and man pages.
 	LongDescription string
 
-	// The namespace of the group
+	// The namespace of the group. The namespace may be changed after the
+	// group has been created and takes effect from the next parse on. Note
+	// that option values set by an earlier parse are not reset, and that
+	// duplicate long names are only detected when the group is added
 	Namespace string
 
-	// The environment namespace of the group
+	// The environment namespace of the group. Like Namespace, it may be
+	// changed after the group has been created
 	EnvNamespace string
 
 	// If true, the group is not displayed in the help or man page
 	Hidden bool
 
+	// The priority of the group in the help and man page. Groups with a
+	// lower priority are shown first, groups with the same priority are
+	// shown in declaration order
+	HelpPriority int
+
 	// The parent of the group or nil if it has no parent
 	parent interface{}
 
@@ -52,6 +96,13 @@ type Group struct {
 	// Whether the group represents the built-in help group
 	isBuiltinHelp bool
 
+	// Whether the group represents the built-in version group (which is
+	// also marked as isBuiltinHelp)
+	isBuiltinVersion bool
+
+	// The field receiving all arguments after a double dash (--), if any
+	passthrough reflect.Value
+
 	data interface{}
 }
 
@@ -85,11 +136,24 @@ func (g *Group) Groups() []*Group {
 	return g.groups
 }
 
-// Options returns the list of options in this group.
+// Options returns the list of options in this group, in the order in which
+// the fields are declared in the group struct. Options of embedded structs
+// without a group tag are listed at the position of the embedded field, and
+// hidden options are included. Options of subgroups are not included.
 func (g *Group) Options() []*Option {
 	return g.options
 }
 
+// OptionAt returns the option at index i of the options in this group (see
+// Options), or nil if i is out of range.
+func (g *Group) OptionAt(i int) *Option {
+	if i < 0 || i >= len(g.options) {
+		return nil
+	}
+
+	return g.options[i]
+}
+
 // Find locates the subgroup with the given short description and returns it.
 // If no such group can be found Find will return nil. Note that the description
 // is matched case insensitively.
@@ -128,10 +192,10 @@ func (g *Group) FindOptionByLongName(longName string) *Option {
 }
 
 // FindOptionByShortName finds an option that is part of the group, or any of
-// its subgroups, by matching its short name.
+// its subgroups, by matching its short name or one of its short aliases.
 func (g *Group) FindOptionByShortName(shortName rune) *Option {
 	return g.findOption(func(option *Option) bool {
-		return option.ShortName == shortName
+		return option.hasShortName(shortName)
 	})
 }
 
@@ -195,6 +259,22 @@ func (g *Group) eachGroup(f func(*Group)) {
 	}
 }
 
+// helpGroups returns the group and all its subgroups in the order in which
+// they are shown in the help.
+func (g *Group) helpGroups() []*Group {
+	var ret []*Group
+
+	g.eachGroup(func(gg *Group) {
+		ret = append(ret, gg)
+	})
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].HelpPriority < ret[j].HelpPriority
+	})
+
+	return ret
+}
+
 func isStringFalsy(s string) bool {
 	return s == "" || s == "false" || s == "no" || s == "0"
 }
@@ -229,30 +309,53 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 			continue
 		}
 
-		// Dive deep into structs or pointers to structs
+		// Dive deep into structs or pointers to structs, except for the
+		// target structs of setter options
 		kind := field.Type.Kind()
 		fld := realval.Field(i)
+		setter := !isStringFalsy(mtag.Get("setter"))
 
-		if kind == reflect.Struct {
+		if kind == reflect.Struct && !setter {
 			if err := g.scanStruct(fld, &field, handler); err != nil {
 				return err
 			}
-		} else if kind == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+		} else if kind == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct && !setter {
 			flagCountBefore := len(g.options) + len(g.groups)
+			allocated := false
 
 			if fld.IsNil() {
 				fld = reflect.New(fld.Type().Elem())
+				allocated = true
 			}
 
 			if err := g.scanStruct(reflect.Indirect(fld), &field, handler); err != nil {
 				return err
 			}
 
-			if len(g.options)+len(g.groups) != flagCountBefore {
+			if allocated && len(g.options)+len(g.groups) != flagCountBefore {
+				// A nil pointer to an embedded unexported struct cannot be
+				// allocated through reflection
+				if !realval.Field(i).CanSet() {
+					return newErrorf(ErrUnknown,
+						"cannot set nil embedded pointer to unexported struct `%s'",
+						field.Type.Elem())
+				}
+
 				realval.Field(i).Set(fld)
 			}
 		}
 
+		if !isStringFalsy(mtag.Get("passthrough")) {
+			if field.Type != reflect.TypeOf([]string{}) {
+				return newErrorf(ErrInvalidTag,
+					"passthrough field `%s' must be of type []string",
+					field.Name)
+			}
+
+			g.passthrough = realval.Field(i)
+			continue
+		}
+
 		longname := mtag.Get("long")
 		shortname := mtag.Get("short")
 
@@ -273,7 +376,27 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 			short, _ = utf8.DecodeRuneInString(shortname)
 		}
 
+		var shortAliases []rune
+
+		for _, alias := range mtag.GetMany("short-aliases") {
+			if utf8.RuneCountInString(alias) != 1 {
+				return newErrorf(ErrShortNameTooLong,
+					"short names can only be 1 character long, not `%s'",
+					alias)
+			}
+
+			r, _ := utf8.DecodeRuneInString(alias)
+			shortAliases = append(shortAliases, r)
+		}
+
+		if len(shortAliases) != 0 && short == 0 {
+			return newErrorf(ErrInvalidTag,
+				"short aliases `%s' require a short name",
+				string(shortAliases))
+		}
+
 		description := mtag.Get("description")
+		summary := mtag.Get("summary")
 		def := mtag.GetMany("default")
 
 		optionalValue := mtag.GetMany("optional-value")
@@ -281,22 +404,42 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 		defaultMask := mtag.Get("default-mask")
 
 		optional := !isStringFalsy(mtag.Get("optional"))
+
+		// An optional value implies an optional argument, unless the
+		// optional tag explicitly says otherwise
+		if len(optionalValue) != 0 && len(mtag.GetMany("optional")) == 0 {
+			optional = true
+		}
 		required := !isStringFalsy(mtag.Get("required"))
 		choices := mtag.GetMany("choice")
 		hidden := !isStringFalsy(mtag.Get("hidden"))
+		experimental := !isStringFalsy(mtag.Get("experimental"))
+
+		var systems []string
+
+		if tag := mtag.Get("os"); tag != "" {
+			for _, system := range strings.Split(tag, ",") {
+				systems = append(systems, strings.TrimSpace(system))
+			}
+		}
 
 		option := &Option{
 			Description:      description,
+			Summary:          summary,
 			ShortName:        short,
+			ShortAliases:     shortAliases,
 			LongName:         longname,
 			Default:          def,
 			OptionalArgument: optional,
 			OptionalValue:    optionalValue,
 			Required:         required,
+			EnvDefaultKey:    mtag.Get("env"),
 			ValueName:        valueName,
 			DefaultMask:      defaultMask,
 			Choices:          choices,
 			Hidden:           hidden,
+			Experimental:     experimental,
+			OS:               systems,
 
 			group: g,
 
@@ -305,18 +448,128 @@ func (g *Group) scanStruct(realval reflect.Value, sfield *reflect.StructField, h
 			tag:   mtag,
 		}
 
+		if delim := mtag.Get("map-delim"); delim != "" {
+			if field.Type.Kind() != reflect.Map {
+				return newErrorf(ErrInvalidTag,
+					"map-delim flag `%s' must be a map",
+					option.shortAndLongName())
+			}
+
+			if option.ValueName == "" {
+				option.ValueName = "key" + delim + "value"
+			}
+		}
+
+		if mtag.Get("sep") != "" && field.Type.Kind() != reflect.Slice {
+			return newErrorf(ErrInvalidTag,
+				"sep flag `%s' must be a slice",
+				option.shortAndLongName())
+		}
+
+		if units := mtag.Get("units"); units != "" {
+			if getUnits(mtag) == nil {
+				return newErrorf(ErrInvalidTag,
+					"invalid units `%s' for flag `%s'",
+					units, option.shortAndLongName())
+			}
+
+			tp := field.Type
+
+			for tp.Kind() == reflect.Ptr || tp.Kind() == reflect.Slice {
+				tp = tp.Elem()
+			}
+
+			if !isIntKind(tp.Kind()) || tp == reflect.TypeOf(time.Duration(0)) {
+				return newErrorf(ErrInvalidTag,
+					"units flag `%s' must be an integer",
+					option.shortAndLongName())
+			}
+		}
+
 		if option.isBool() && option.Default != nil {
 			return newErrorf(ErrInvalidTag,
 				"boolean flag `%s' may not have default values, they always default to `false' and can only be turned on",
 				option.shortAndLongName())
 		}
 
+		if !isStringFalsy(mtag.Get("counter")) && !isIntKind(field.Type.Kind()) {
+			return newErrorf(ErrInvalidTag,
+				"counter flag `%s' must be an integer",
+				option.shortAndLongName())
+		}
+
+		if err := option.parseCountLimits(); err != nil {
+			return err
+		}
+
+		if !isStringFalsy(mtag.Get("clearable")) && field.Type.Kind() != reflect.Slice && field.Type.Kind() != reflect.Map {
+			return newErrorf(ErrInvalidTag,
+				"clearable flag `%s' must be a slice or a map",
+				option.shortAndLongName())
+		}
+
+		if !isStringFalsy(mtag.Get("append-operator")) && field.Type.Kind() != reflect.Slice && field.Type.Kind() != reflect.Map {
+			return newErrorf(ErrInvalidTag,
+				"append-operator flag `%s' must be a slice or a map",
+				option.shortAndLongName())
+		}
+
+		if isFileType(field.Type) {
+			if _, _, ok := fileOpenFlags(field.Type, mtag.Get("open-mode")); !ok {
+				return newErrorf(ErrInvalidTag,
+					"invalid open-mode `%s' for flag `%s'",
+					mtag.Get("open-mode"), option.shortAndLongName())
+			}
+		}
+
+		if !isStringFalsy(mtag.Get("abs-path")) && !isStringOrStringSlice(field.Type) {
+			return newErrorf(ErrInvalidTag,
+				"abs-path flag `%s' must be a string or a slice of strings",
+				option.shortAndLongName())
+		}
+
+		if setter && !isStructOrStructPtr(field.Type) {
+			return newErrorf(ErrInvalidTag,
+				"setter flag `%s' must be a struct or a pointer to a struct",
+				option.shortAndLongName())
+		}
+
 		g.options = append(g.options, option)
 	}
 
 	return nil
 }
 
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+func isStringOrStringSlice(tp reflect.Type) bool {
+	if tp.Kind() == reflect.Slice {
+		tp = tp.Elem()
+	}
+
+	if tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	return tp.Kind() == reflect.String
+}
+
+func isStructOrStructPtr(tp reflect.Type) bool {
+	if tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	return tp.Kind() == reflect.Struct
+}
+
 func (g *Group) checkForDuplicateFlags() *Error {
 	shortNames := make(map[rune]*Option)
 	longNames := make(map[string]*Option)
@@ -334,12 +587,12 @@ func (g *Group) checkForDuplicateFlags() *Error {
 				}
 				longNames[longName] = option
 			}
-			if option.ShortName != 0 {
-				if otherOption, ok := shortNames[option.ShortName]; ok {
+			for _, shortName := range option.shortNames() {
+				if otherOption, ok := shortNames[shortName]; ok {
 					duplicateError = newErrorf(ErrDuplicatedFlag, "option `%s' uses the same short name as option `%s'", option, otherOption)
 					return
 				}
-				shortNames[option.ShortName] = option
+				shortNames[shortName] = option
 			}
 		}
 	})
@@ -369,6 +622,12 @@ func (g *Group) scanSubGroupHandler(realval reflect.Value, sfield *reflect.Struc
 			ptrval = realval.Addr()
 		}
 
+		if !ptrval.CanInterface() {
+			return true, newErrorf(ErrInvalidTag,
+				"group `%s' cannot be used on unexported embedded struct `%s'",
+				subgroup, sfield.Type)
+		}
+
 		description := mtag.Get("description")
 
 		group, err := g.AddGroup(subgroup, description, ptrval.Interface())
@@ -381,6 +640,14 @@ func (g *Group) scanSubGroupHandler(realval reflect.Value, sfield *reflect.Struc
 		group.EnvNamespace = mtag.Get("env-namespace")
 		group.Hidden = mtag.Get("hidden") != ""
 
+		if priority := mtag.Get("help-priority"); priority != "" {
+			if group.HelpPriority, err = strconv.Atoi(priority); err != nil {
+				return true, newErrorf(ErrInvalidTag,
+					"invalid help-priority `%s' for group `%s'",
+					priority, subgroup)
+			}
+		}
+
 		return true, nil
 	}
 
@@ -140,6 +140,238 @@ func TestGroupNestedInlineNamespace(t *testing.T) {
 	}
 }
 
+func TestGroupNamespaceChange(t *testing.T) {
+	type shared struct {
+		Opt string `long:"opt"`
+	}
+
+	var first, second shared
+
+	p := NewNamedParser("test", None)
+
+	c1, err := p.AddCommand("one", "", "", &struct{}{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c2, err := p.AddCommand("two", "", "", &struct{}{})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g1, err := c1.AddGroup("Shared", "", &first)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g2, err := c2.AddGroup("Shared", "", &second)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	g1.Namespace = "first"
+	g2.Namespace = "second"
+
+	if _, err := p.ParseArgs([]string{"one", "--first.opt", "a"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := p.ParseArgs([]string{"two", "--second.opt", "b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, first.Opt, "a")
+	assertString(t, second.Opt, "b")
+	assertString(t, g1.Options()[0].LongNameWithNamespace(), "first.opt")
+
+	g1.Namespace = "renamed"
+
+	if _, err := p.ParseArgs([]string{"one", "--renamed.opt", "c"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, first.Opt, "c")
+
+	_, err = p.ParseArgs([]string{"one", "--first.opt", "d"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `first.opt'")
+}
+
+func TestGroupNamespaceDelimiters(t *testing.T) {
+	var opts = struct {
+		Opt string `long:"opt" env:"OPT"`
+
+		Group struct {
+			Opt string `long:"opt" env:"OPT"`
+
+			Group struct {
+				Opt string `long:"opt" env:"OPT"`
+			} `group:"Subsubgroup" namespace:"sap" env-namespace:"SAP"`
+		} `group:"Subgroup" namespace:"sip" env-namespace:"SIP"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.NamespaceDelimiter = "/"
+	p.EnvNamespaceDelimiter = "__"
+
+	if _, err := p.ParseArgs([]string{"--sip/opt", "b", "--sip/sap/opt", "c"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Group.Opt, "b")
+	assertString(t, opts.Group.Group.Opt, "c")
+
+	var longNames, envKeys []string
+
+	p.EachOption(func(c *Command, g *Group, option *Option) {
+		if option.EnvDefaultKey != "" {
+			longNames = append(longNames, option.LongNameWithNamespace())
+			envKeys = append(envKeys, option.EnvKeyWithNamespace())
+		}
+	})
+
+	assertStringArray(t, longNames, []string{"opt", "sip/opt", "sip/sap/opt"})
+	assertStringArray(t, envKeys, []string{"OPT", "SIP__OPT", "SIP__SAP__OPT"})
+}
+
+func TestOptionEnvKeys(t *testing.T) {
+	var opts = struct {
+		Opt   string `long:"opt" env:"OPT"`
+		NoEnv string `long:"no-env"`
+
+		Group struct {
+			Opt string `long:"opt" env:"OPT"`
+		} `group:"Subgroup" namespace:"sip" env-namespace:"SIP"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	assertStringArray(t, p.FindOptionByLongName("opt").EnvKeys(), []string{"OPT"})
+	assertStringArray(t, p.FindOptionByLongName("sip.opt").EnvKeys(), []string{"SIP_OPT"})
+
+	if keys := p.FindOptionByLongName("no-env").EnvKeys(); keys == nil || len(keys) != 0 {
+		t.Errorf("Expected an empty slice, but got %#v", keys)
+	}
+}
+
+func TestGroupOptionOrder(t *testing.T) {
+	type embedded struct {
+		B string `long:"b"`
+		C string `long:"c" hidden:"yes"`
+	}
+
+	var opts = struct {
+		A string `long:"a"`
+		embedded
+		D string `long:"d"`
+
+		Group struct {
+			E string `long:"e"`
+		} `group:"Subgroup"`
+
+		F string `long:"f"`
+	}{}
+
+	p := NewNamedParser("test", None)
+	g, err := p.AddGroup("Application Options", "", &opts)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+
+	for i := range g.Options() {
+		names = append(names, g.OptionAt(i).LongName)
+	}
+
+	assertStringArray(t, names, []string{"a", "b", "c", "d", "f"})
+
+	if g.OptionAt(-1) != nil || g.OptionAt(len(g.Options())) != nil {
+		t.Errorf("Expected nil for an out of range index")
+	}
+}
+
+type embeddedOptions struct {
+	Embedded string `long:"embedded"`
+}
+
+type EmbeddedOptions struct {
+	Exported string `long:"exported"`
+}
+
+func TestGroupEmbedded(t *testing.T) {
+	var opts = struct {
+		embeddedOptions
+		*EmbeddedOptions
+
+		Value string `long:"value"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "--embedded", "a", "--exported", "b", "--value", "c", "rest")
+
+	assertStringArray(t, ret, []string{"rest"})
+
+	assertString(t, opts.Embedded, "a")
+	assertString(t, opts.Exported, "b")
+	assertString(t, opts.Value, "c")
+
+	var names []string
+
+	for _, option := range p.Groups()[0].Options() {
+		names = append(names, option.LongNameWithNamespace())
+	}
+
+	assertStringArray(t, names, []string{"embedded", "exported", "value"})
+}
+
+func TestGroupEmbeddedNamespace(t *testing.T) {
+	var opts = struct {
+		*EmbeddedOptions `group:"Exported" namespace:"exp"`
+
+		Value string `long:"value"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "--exp.exported", "b", "--value", "c")
+
+	assertStringArray(t, ret, []string{})
+
+	assertString(t, opts.Exported, "b")
+	assertString(t, opts.Value, "c")
+
+	if p.Command.Group.Find("Exported") == nil {
+		t.Errorf("Expected to find group `Exported'")
+	}
+
+	if len(p.Groups()[0].Options()) != 1 {
+		t.Errorf("Expected only one option in the top level group, but got %d", len(p.Groups()[0].Options()))
+	}
+}
+
+func TestGroupEmbeddedUnexportedNamespace(t *testing.T) {
+	var opts = struct {
+		embeddedOptions `group:"Embedded" namespace:"emb"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "group `Embedded' cannot be used on unexported embedded struct `flags.embeddedOptions'", &opts)
+}
+
+func TestGroupEmbeddedUnexportedPointer(t *testing.T) {
+	var opts = struct {
+		*embeddedOptions
+	}{}
+
+	assertParseFail(t, ErrUnknown, "cannot set nil embedded pointer to unexported struct `flags.embeddedOptions'", &opts)
+
+	opts.embeddedOptions = &embeddedOptions{}
+	assertParseSuccess(t, &opts, "--embedded", "a")
+
+	assertString(t, opts.Embedded, "a")
+}
+
 func TestDuplicateShortFlags(t *testing.T) {
 	var opts struct {
 		Verbose   []bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
@@ -269,3 +501,41 @@ func TestAddOptionNonOptional(t *testing.T) {
 		t.Errorf("option not set")
 	}
 }
+
+func TestOptionDefaultStrings(t *testing.T) {
+	var opts struct {
+		None  string   `long:"none"`
+		Empty string   `long:"empty" default:""`
+		Value int      `long:"value" default:"0x10"`
+		Slice []string `long:"slice" default:"a" default:"b"`
+	}
+
+	p := NewParser(&opts, None)
+
+	tests := []struct {
+		name     string
+		has      bool
+		defaults []string
+	}{
+		{"none", false, nil},
+		{"empty", true, []string{""}},
+		{"value", true, []string{"0x10"}},
+		{"slice", true, []string{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		opt := p.FindOptionByLongName(test.name)
+
+		if opt.HasDefault() != test.has {
+			t.Errorf("Expected HasDefault of `%s' to be %v", test.name, test.has)
+		}
+
+		if test.defaults == nil {
+			if opt.DefaultStrings() != nil {
+				t.Errorf("Expected no defaults for `%s', but got %v", test.name, opt.DefaultStrings())
+			}
+		} else {
+			assertStringArray(t, opt.DefaultStrings(), test.defaults)
+		}
+	}
+}
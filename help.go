@@ -9,16 +9,30 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"unicode/utf8"
 )
 
-type alignmentInfo struct {
-	maxLongLen      int
-	hasShort        bool
-	hasValueName    bool
-	terminalColumns int
-	indent          bool
+// AlignmentInfo describes the column layout used for the options in the
+// built-in help message. It can be used by custom help renderers to match
+// the built-in layout.
+type AlignmentInfo struct {
+	// The width of the widest option long name, including its namespace,
+	// value name and choices
+	MaxLongLen int
+
+	// Whether any option has a short name
+	HasShort bool
+
+	// Whether any option has a value name
+	HasValueName bool
+
+	// The width of the terminal the help is wrapped to
+	TerminalColumns int
+
+	// Whether options are indented, as is done for command options
+	Indent bool
 }
 
 const (
@@ -26,46 +40,66 @@ const (
 	distanceBetweenOptionAndDescription = 2
 )
 
-func (a *alignmentInfo) descriptionStart() int {
-	ret := a.maxLongLen + distanceBetweenOptionAndDescription
+// OptionStart returns the column at which option names start.
+func (a *AlignmentInfo) OptionStart() int {
+	if a.Indent {
+		return paddingBeforeOption + 4
+	}
 
-	if a.hasShort {
+	return paddingBeforeOption
+}
+
+// DescriptionStart returns the column at which option descriptions start.
+func (a *AlignmentInfo) DescriptionStart() int {
+	return a.descriptionStart() + paddingBeforeOption
+}
+
+func (a *AlignmentInfo) descriptionStart() int {
+	ret := a.MaxLongLen + distanceBetweenOptionAndDescription
+
+	if a.HasShort {
 		ret += 2
 	}
 
-	if a.maxLongLen > 0 {
+	if a.MaxLongLen > 0 {
 		ret += 4
 	}
 
-	if a.hasValueName {
+	if a.HasValueName {
 		ret += 3
 	}
 
 	return ret
 }
 
-func (a *alignmentInfo) updateLen(name string, indent bool) {
+func (a *AlignmentInfo) updateLen(name string, indent bool) {
 	l := utf8.RuneCountInString(name)
 
 	if indent {
 		l = l + 4
 	}
 
-	if l > a.maxLongLen {
-		a.maxLongLen = l
+	if l > a.MaxLongLen {
+		a.MaxLongLen = l
 	}
 }
 
-func (p *Parser) getAlignmentInfo() alignmentInfo {
-	ret := alignmentInfo{
-		maxLongLen:      0,
-		hasShort:        false,
-		hasValueName:    false,
-		terminalColumns: getTerminalColumns(),
+// AlignmentInfo returns the column layout of the options of the active
+// commands, as used by WriteHelp.
+func (p *Parser) AlignmentInfo() AlignmentInfo {
+	return p.getAlignmentInfo()
+}
+
+func (p *Parser) getAlignmentInfo() AlignmentInfo {
+	ret := AlignmentInfo{
+		MaxLongLen:      0,
+		HasShort:        false,
+		HasValueName:    false,
+		TerminalColumns: getTerminalColumns(),
 	}
 
-	if ret.terminalColumns <= 0 {
-		ret.terminalColumns = 80
+	if ret.TerminalColumns <= 0 {
+		ret.TerminalColumns = 80
 	}
 
 	var prevcmd *Command
@@ -77,7 +111,7 @@ func (p *Parser) getAlignmentInfo() alignmentInfo {
 			}
 			prevcmd = c
 		}
-		if !grp.showInHelp() {
+		if !grp.showInHelp() || (grp.isBuiltinHelp && !grp.isBuiltinVersion && !p.ShowHelpGroup) {
 			return
 		}
 		for _, info := range grp.options {
@@ -86,17 +120,17 @@ func (p *Parser) getAlignmentInfo() alignmentInfo {
 			}
 
 			if info.ShortName != 0 {
-				ret.hasShort = true
+				ret.HasShort = true
 			}
 
 			if len(info.ValueName) > 0 {
-				ret.hasValueName = true
+				ret.HasValueName = true
 			}
 
 			l := info.LongNameWithNamespace() + info.ValueName
 
 			if len(info.Choices) != 0 {
-				l += "[" + strings.Join(info.Choices, "|") + "]"
+				l += "[" + strings.Join(info.displayChoices(), "|") + "]"
 			}
 
 			ret.updateLen(l, c != p.Command)
@@ -119,33 +153,39 @@ func wrapText(s string, l int, prefix string) string {
 	for _, line := range lines {
 		var retline string
 
-		line = strings.TrimSpace(line)
+		// Lines starting with a tab are pre-formatted and are kept as
+		// they are, with the tab replaced by an indentation
+		if strings.HasPrefix(line, "\t") {
+			retline = "    " + strings.TrimRight(line[1:], " ")
+		} else {
+			line = strings.TrimSpace(line)
 
-		for len(line) > l {
-			// Try to split on space
-			suffix := ""
+			for len(line) > l {
+				// Try to split on space
+				suffix := ""
 
-			pos := strings.LastIndex(line[:l], " ")
+				pos := strings.LastIndex(line[:l], " ")
 
-			if pos < 0 {
-				pos = l - 1
-				suffix = "-\n"
-			}
+				if pos < 0 {
+					pos = l - 1
+					suffix = "-\n"
+				}
+
+				if len(retline) != 0 {
+					retline += "\n" + prefix
+				}
 
-			if len(retline) != 0 {
-				retline += "\n" + prefix
+				retline += strings.TrimSpace(line[:pos]) + suffix
+				line = strings.TrimSpace(line[pos:])
 			}
 
-			retline += strings.TrimSpace(line[:pos]) + suffix
-			line = strings.TrimSpace(line[pos:])
-		}
+			if len(line) > 0 {
+				if len(retline) != 0 {
+					retline += "\n" + prefix
+				}
 
-		if len(line) > 0 {
-			if len(retline) != 0 {
-				retline += "\n" + prefix
+				retline += line
 			}
-
-			retline += line
 		}
 
 		if len(ret) > 0 {
@@ -162,34 +202,28 @@ func wrapText(s string, l int, prefix string) string {
 	return ret
 }
 
-func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alignmentInfo) {
+func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info AlignmentInfo) {
 	line := &bytes.Buffer{}
 
-	prefix := paddingBeforeOption
-
-	if info.indent {
-		prefix += 4
-	}
-
-	if option.Hidden {
+	if option.isHidden() {
 		return
 	}
 
-	line.WriteString(strings.Repeat(" ", prefix))
+	line.WriteString(strings.Repeat(" ", info.OptionStart()))
 
 	if option.ShortName != 0 {
 		line.WriteRune(defaultShortOptDelimiter)
 		line.WriteRune(option.ShortName)
-	} else if info.hasShort {
+	} else if info.HasShort {
 		line.WriteString("  ")
 	}
 
-	descstart := info.descriptionStart() + paddingBeforeOption
+	descstart := info.DescriptionStart()
 
 	if len(option.LongName) > 0 {
 		if option.ShortName != 0 {
 			line.WriteString(", ")
-		} else if info.hasShort {
+		} else if info.HasShort {
 			line.WriteString("  ")
 		}
 
@@ -205,14 +239,28 @@ func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alig
 		}
 
 		if len(option.Choices) > 0 {
-			line.WriteString("[" + strings.Join(option.Choices, "|") + "]")
+			line.WriteString("[" + strings.Join(option.displayChoices(), "|") + "]")
 		}
 	}
 
 	written := line.Len()
 	line.WriteTo(writer)
 
-	if option.Description != "" {
+	desc := option.description()
+
+	if p.CompactHelp && option.Summary != "" {
+		desc = option.Summary
+	}
+
+	if option.Experimental {
+		if desc != "" {
+			desc += " "
+		}
+
+		desc += "(experimental)"
+	}
+
+	if desc != "" {
 		dw := descstart - written
 		writer.WriteString(strings.Repeat(" ", dw))
 
@@ -222,20 +270,18 @@ func (p *Parser) writeHelpOption(writer *bufio.Writer, option *Option, info alig
 			if option.DefaultMask != "-" {
 				def = option.DefaultMask
 			}
+		} else if len(option.defaultLiteral) != 0 && p.MaskDefaults {
+			def = "***"
 		} else {
 			def = option.defaultLiteral
 		}
 
-		var desc string
-
 		if def != "" {
-			desc = fmt.Sprintf("%s (default: %v)", option.Description, def)
-		} else {
-			desc = option.Description
+			desc = fmt.Sprintf("%s (default: %v)", desc, def)
 		}
 
 		writer.WriteString(wrapText(desc,
-			info.terminalColumns-descstart,
+			info.TerminalColumns-descstart,
 			strings.Repeat(" ", descstart)))
 	}
 
@@ -260,113 +306,163 @@ func maxCommandLength(s []*Command) int {
 	return ret
 }
 
-// WriteHelp writes a help message containing all the possible options and
-// their descriptions to the provided writer. Note that the HelpFlag parser
-// option provides a convenient way to add a -h/--help option group to the
-// command line parser which will automatically show the help messages using
-// this method.
-func (p *Parser) WriteHelp(writer io.Writer) {
-	if writer == nil {
-		return
+// helpOptions returns the options of the group in the order in which they are
+// shown in the help and man page.
+func (p *Parser) helpOptions(g *Group) []*Option {
+	if !p.SortOptions {
+		return g.options
 	}
 
-	wr := bufio.NewWriter(writer)
-	aligninfo := p.getAlignmentInfo()
+	ret := make([]*Option, len(g.options))
+	copy(ret, g.options)
 
-	cmd := p.Command
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
 
-	for cmd.Active != nil {
-		cmd = cmd.Active
-	}
+		if len(a.LongName) == 0 || len(b.LongName) == 0 {
+			if len(a.LongName) != len(b.LongName) {
+				return len(a.LongName) != 0
+			}
 
-	if p.Name != "" {
-		wr.WriteString("Usage:\n")
-		wr.WriteString(" ")
+			return a.ShortName < b.ShortName
+		}
 
-		allcmd := p.Command
+		return a.LongName < b.LongName
+	})
 
-		for allcmd != nil {
-			var usage string
+	return ret
+}
 
-			if allcmd == p.Command {
-				if len(p.Usage) != 0 {
-					usage = p.Usage
-				} else if p.Options&HelpFlag != 0 {
-					usage = "[OPTIONS]"
-				}
-			} else if us, ok := allcmd.data.(Usage); ok {
-				usage = us.Usage()
-			} else if allcmd.hasHelpOptions() {
-				usage = fmt.Sprintf("[%s-OPTIONS]", allcmd.Name)
-			}
+// writeUsage writes the synopsis of the active command path, starting with a
+// space.
+func (p *Parser) writeUsage(wr *bufio.Writer) {
+	allcmd := p.Command
 
-			if len(usage) != 0 {
-				fmt.Fprintf(wr, " %s %s", allcmd.Name, usage)
-			} else {
-				fmt.Fprintf(wr, " %s", allcmd.Name)
+	for allcmd != nil {
+		var usage string
+
+		if allcmd == p.Command {
+			if len(p.Usage) != 0 {
+				usage = p.Usage
+			} else if p.Options&HelpFlag != 0 {
+				usage = "[OPTIONS]"
 			}
+		} else if us, ok := allcmd.data.(Usage); ok {
+			usage = us.Usage()
+		} else if allcmd.hasHelpOptions() {
+			usage = fmt.Sprintf("[%s-OPTIONS]", allcmd.Name)
+		}
 
-			if len(allcmd.args) > 0 {
+		if len(usage) != 0 {
+			fmt.Fprintf(wr, " %s %s", allcmd.Name, usage)
+		} else {
+			fmt.Fprintf(wr, " %s", allcmd.Name)
+		}
+
+		if len(allcmd.args) > 0 {
+			fmt.Fprintf(wr, " ")
+		}
+
+		for i, arg := range allcmd.args {
+			if i != 0 {
 				fmt.Fprintf(wr, " ")
 			}
 
-			for i, arg := range allcmd.args {
-				if i != 0 {
-					fmt.Fprintf(wr, " ")
-				}
-
-				name := arg.Name
+			name := arg.Name
 
-				if arg.isRemaining() {
-					name = name + "..."
-				}
+			if arg.isRemaining() {
+				name = name + "..."
+			}
 
-				if !allcmd.ArgsRequired {
-					if arg.Required > 0 {
-						fmt.Fprintf(wr, "%s", name)
-					} else {
-						fmt.Fprintf(wr, "[%s]", name)
-					}
-				} else {
+			if !allcmd.ArgsRequired {
+				if arg.Required > 0 {
 					fmt.Fprintf(wr, "%s", name)
+				} else {
+					fmt.Fprintf(wr, "[%s]", name)
 				}
+			} else {
+				fmt.Fprintf(wr, "%s", name)
 			}
+		}
 
-			if allcmd.Active == nil && len(allcmd.commands) > 0 {
-				var co, cc string
+		if allcmd.Active == nil && len(allcmd.visibleCommands()) > 0 {
+			var co, cc string
 
-				if allcmd.SubcommandsOptional {
-					co, cc = "[", "]"
-				} else {
-					co, cc = "<", ">"
-				}
-
-				visibleCommands := allcmd.visibleCommands()
+			if !allcmd.requiresSubcommand() {
+				co, cc = "[", "]"
+			} else {
+				co, cc = "<", ">"
+			}
 
-				if len(visibleCommands) > 3 {
-					fmt.Fprintf(wr, " %scommand%s", co, cc)
-				} else {
-					subcommands := allcmd.sortedVisibleCommands()
-					names := make([]string, len(subcommands))
+			visibleCommands := allcmd.visibleCommands()
 
-					for i, subc := range subcommands {
-						names[i] = subc.Name
-					}
+			if len(visibleCommands) > 3 {
+				fmt.Fprintf(wr, " %scommand%s", co, cc)
+			} else {
+				subcommands := allcmd.sortedVisibleCommands()
+				names := make([]string, len(subcommands))
 
-					fmt.Fprintf(wr, " %s%s%s", co, strings.Join(names, " | "), cc)
+				for i, subc := range subcommands {
+					names[i] = subc.Name
 				}
-			}
 
-			allcmd = allcmd.Active
+				fmt.Fprintf(wr, " %s%s%s", co, strings.Join(names, " | "), cc)
+			}
 		}
 
+		allcmd = allcmd.Active
+	}
+}
+
+// WriteUsageLine writes only the usage line of the help message (e.g.
+// "Usage: app [OPTIONS] <command>") for the active command path to the
+// specified writer. Nothing is written if the parser has no name.
+func (p *Parser) WriteUsageLine(writer io.Writer) {
+	if writer == nil || p.Name == "" {
+		return
+	}
+
+	wr := bufio.NewWriter(writer)
+
+	wr.WriteString("Usage:")
+	p.writeUsage(wr)
+	wr.WriteString("\n")
+
+	wr.Flush()
+}
+
+// WriteHelp writes a help message containing all the possible options and
+// their descriptions to the provided writer. Note that the HelpFlag parser
+// option provides a convenient way to add a -h/--help option group to the
+// command line parser which will automatically show the help messages using
+// this method.
+func (p *Parser) WriteHelp(writer io.Writer) {
+	if writer == nil {
+		return
+	}
+
+	wr := bufio.NewWriter(writer)
+	aligninfo := p.getAlignmentInfo()
+
+	cmd := p.Command
+
+	for cmd.Active != nil {
+		cmd = cmd.Active
+	}
+
+	if p.Name != "" {
+		wr.WriteString("Usage:\n")
+		wr.WriteString(" ")
+
+		p.writeUsage(wr)
+
 		fmt.Fprintln(wr)
 
 		if len(cmd.LongDescription) != 0 {
 			fmt.Fprintln(wr)
 
 			t := wrapText(cmd.LongDescription,
-				aligninfo.terminalColumns,
+				aligninfo.TerminalColumns,
 				"")
 
 			fmt.Fprintln(wr, t)
@@ -378,30 +474,34 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 	for c != nil {
 		printcmd := c != p.Command
 
-		c.eachGroup(func(grp *Group) {
+		for _, grp := range c.helpGroups() {
 			first := true
 
 			// Skip built-in help group for all commands except the top-level
 			// parser
 			if grp.Hidden || (grp.isBuiltinHelp && c != p.Command) {
-				return
+				continue
 			}
 
-			for _, info := range grp.options {
+			if grp.isBuiltinHelp && !grp.isBuiltinVersion && !p.ShowHelpGroup {
+				continue
+			}
+
+			for _, info := range p.helpOptions(grp) {
 				if !info.showInHelp() {
 					continue
 				}
 
 				if printcmd {
 					fmt.Fprintf(wr, "\n[%s command options]\n", c.Name)
-					aligninfo.indent = true
+					aligninfo.Indent = true
 					printcmd = false
 				}
 
 				if first && cmd.Group != grp {
 					fmt.Fprintln(wr)
 
-					if aligninfo.indent {
+					if aligninfo.Indent {
 						wr.WriteString("    ")
 					}
 
@@ -411,7 +511,7 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 
 				p.writeHelpOption(wr, info, aligninfo)
 			}
-		})
+		}
 
 		var args []*Arg
 		for _, arg := range c.args {
@@ -420,14 +520,22 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 			}
 		}
 
-		if len(args) > 0 {
+		if len(args) > 0 || (len(c.args) > 0 && c.ArgsDescription != "") {
 			if c == p.Command {
 				fmt.Fprintf(wr, "\nArguments:\n")
 			} else {
 				fmt.Fprintf(wr, "\n[%s command arguments]\n", c.Name)
 			}
 
-			descStart := aligninfo.descriptionStart() + paddingBeforeOption
+			if c.ArgsDescription != "" {
+				prefix := strings.Repeat(" ", paddingBeforeOption)
+
+				wr.WriteString(prefix)
+				wr.WriteString(wrapText(c.ArgsDescription, aligninfo.TerminalColumns-1-paddingBeforeOption, prefix))
+				fmt.Fprintln(wr)
+			}
+
+			descStart := aligninfo.DescriptionStart()
 
 			for _, arg := range args {
 				argPrefix := strings.Repeat(" ", paddingBeforeOption)
@@ -440,7 +548,7 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 					// Space between "arg:" and the description start
 					descPadding := strings.Repeat(" ", descStart-len(argPrefix))
 					// How much space the description gets before wrapping
-					descWidth := aligninfo.terminalColumns - 1 - descStart
+					descWidth := aligninfo.TerminalColumns - 1 - descStart
 					// Whitespace to which we can indent new description lines
 					descPrefix := strings.Repeat(" ", descStart)
 
@@ -462,29 +570,132 @@ func (p *Parser) WriteHelp(writer io.Writer) {
 	if len(scommands) > 0 {
 		maxnamelen := maxCommandLength(scommands)
 
-		fmt.Fprintln(wr)
-		fmt.Fprintln(wr, "Available commands:")
+		for _, category := range cmd.visibleCommandCategories() {
+			fmt.Fprintln(wr)
 
-		for _, c := range scommands {
-			fmt.Fprintf(wr, "  %s", c.Name)
+			if category.Name == "" {
+				fmt.Fprintln(wr, "Available commands:")
+			} else {
+				fmt.Fprintf(wr, "%s:\n", category.Name)
+			}
+
+			for _, c := range category.Commands {
+				fmt.Fprintf(wr, "  %s", c.Name)
+
+				if len(c.ShortDescription) > 0 {
+					pad := strings.Repeat(" ", maxnamelen-len(c.Name))
+					desc := c.ShortDescription
 
-			if len(c.ShortDescription) > 0 {
-				pad := strings.Repeat(" ", maxnamelen-len(c.Name))
-				fmt.Fprintf(wr, "%s  %s", pad, c.ShortDescription)
+					if len(c.Aliases) > 0 {
+						desc += fmt.Sprintf(" (aliases: %s)", strings.Join(c.Aliases, ", "))
+					}
+
+					// Wrap the description to the terminal width, with
+					// continuation lines indented under the description
+					descStart := 2 + maxnamelen + 2
 
-				if len(c.Aliases) > 0 {
-					fmt.Fprintf(wr, " (aliases: %s)", strings.Join(c.Aliases, ", "))
+					fmt.Fprintf(wr, "%s  %s", pad, wrapText(desc,
+						aligninfo.TerminalColumns-descStart,
+						strings.Repeat(" ", descStart)))
 				}
 
+				fmt.Fprintln(wr)
 			}
+		}
+	}
+
+	epilogues := []string{cmd.Epilogue}
+
+	if cmd != p.Command {
+		epilogues = append(epilogues, p.Epilogue)
+	}
 
+	for _, epilogue := range epilogues {
+		if epilogue != "" {
 			fmt.Fprintln(wr)
+			fmt.Fprintln(wr, wrapText(epilogue, aligninfo.TerminalColumns, ""))
 		}
 	}
 
 	wr.Flush()
 }
 
+// WriteHelpFor writes the help message for the command, or single option,
+// identified by path to the specified writer. The path consists of (sub)command
+// names, optionally followed by the name of an option of the last command
+// (e.g. "deploy", "--force"). Without a path, the help message of the parser
+// itself is written. An error of type ErrUnknownCommand or ErrUnknownFlag is
+// returned, and nothing is written, if the path cannot be resolved.
+func (p *Parser) WriteHelpFor(writer io.Writer, path ...string) error {
+	cmd := p.Command
+
+	var cmds []*Command
+	var option *Option
+
+	for i, name := range path {
+		if c := cmd.Find(name); c != nil {
+			if err := p.loadCommand(c); err != nil {
+				return err
+			}
+
+			cmds = append(cmds, c)
+			cmd = c
+
+			continue
+		}
+
+		if i == len(path)-1 {
+			_, optname, _ := stripOptionPrefix(name)
+
+			if option = cmd.FindOptionByLongName(optname); option == nil && utf8.RuneCountInString(optname) == 1 {
+				r, _ := utf8.DecodeRuneInString(optname)
+				option = cmd.FindOptionByShortName(r)
+			}
+
+			if option != nil {
+				break
+			}
+
+			if argumentIsOption(name) {
+				return newErrorf(ErrUnknownFlag, "unknown flag `%s'", optname)
+			}
+		}
+
+		return newErrorf(ErrUnknownCommand, "Unknown command `%s'", name)
+	}
+
+	// Activate the commands of the path while writing the help, and restore
+	// the previously active commands afterwards
+	chain := append([]*Command{p.Command}, cmds...)
+	active := make([]*Command, len(chain))
+
+	for i, c := range chain {
+		active[i] = c.Active
+
+		if i+1 < len(chain) {
+			c.Active = chain[i+1]
+		} else {
+			c.Active = nil
+		}
+	}
+
+	defer func() {
+		for i, c := range chain {
+			c.Active = active[i]
+		}
+	}()
+
+	if option == nil {
+		p.WriteHelp(writer)
+		return nil
+	}
+
+	wr := bufio.NewWriter(writer)
+	p.writeHelpOption(wr, option, p.getAlignmentInfo())
+
+	return wr.Flush()
+}
+
 // WroteHelp is a helper to test the error from ParseArgs() to
 // determine if the help message was written. It is safe to
 // call without first checking that error is nil.
@@ -232,21 +232,21 @@ Call phone number
 \fB\fB\-\-ptrslice\fR\fP
 A slice of pointers to string
 .TP
-\fB\fB\-\-empty-description\fR\fP
+\fB\fB\-\-empty\-description\fR\fP
 .TP
 \fB\fB\-\-default\fR <default: \fI"Some\\nvalue"\fR>\fP
 Test default value
 .TP
-\fB\fB\-\-default-array\fR <default: \fI"Some value", "Other\\tvalue"\fR>\fP
+\fB\fB\-\-default\-array\fR <default: \fI"Some value", "Other\\tvalue"\fR>\fP
 Test default array value
 .TP
-\fB\fB\-\-default-map\fR <default: \fI"some:value", "another:value"\fR>\fP
+\fB\fB\-\-default\-map\fR <default: \fI"some:value", "another:value"\fR>\fP
 Testdefault map value
 .TP
-\fB\fB\-\-opt-with-arg-name\fR \fIsomething\fR\fP
+\fB\fB\-\-opt\-with\-arg\-name\fR \fIsomething\fR\fP
 Option with named argument
 .TP
-\fB\fB\-\-opt-with-choices\fR \fIchoice\fR\fP
+\fB\fB\-\-opt\-with\-choices\fR \fIchoice\fR\fP
 Option with choices
 .SS Other Options
 .TP
@@ -260,7 +260,7 @@ A map from string to int
 \fB\fB\-\-sip.opt\fR\fP
 This is a subgroup option
 .TP
-\fB\fB\-\-sip.not-hidden-inside-group\fR\fP
+\fB\fB\-\-sip.not\-hidden\-inside\-group\fR\fP
 Not hidden inside group
 .SS Subsubgroup
 .TP
@@ -276,20 +276,20 @@ A command
 
 Longer \fBcommand\fP description
 
-\fBUsage\fP: TestMan [OPTIONS] command [command-OPTIONS]
+\fBUsage\fP: TestMan [OPTIONS] command [command\-OPTIONS]
 .TP
 
 \fBAliases\fP: cm, cmd
 
 .TP
-\fB\fB\-\-extra-verbose\fR\fP
+\fB\fB\-\-extra\-verbose\fR\fP
 Use for extra verbosity
 .SS parent
 A parent command
 
 Longer \fBparent\fP description
 
-\fBUsage\fP: TestMan [OPTIONS] parent [parent-OPTIONS]
+\fBUsage\fP: TestMan [OPTIONS] parent [parent\-OPTIONS]
 .TP
 .TP
 \fB\fB\-\-opt\fR\fP
@@ -297,7 +297,7 @@ This is a parent command option
 .SS parent sub
 A sub command
 
-\fBUsage\fP: TestMan [OPTIONS] parent [parent-OPTIONS] sub [sub-OPTIONS]
+\fBUsage\fP: TestMan [OPTIONS] parent [parent\-OPTIONS] sub [sub\-OPTIONS]
 .TP
 .TP
 \fB\fB\-\-opt\fR\fP
@@ -307,6 +307,149 @@ This is a sub command option
 	assertDiff(t, got, expected, "man page")
 }
 
+func TestManSections(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" description:"Verbose output"`
+	}
+
+	p := NewNamedParser("TestMan", None)
+	p.ShortDescription = "Test manpage generation"
+	p.AddGroup("Application Options", "", &opts)
+
+	p.ManSection = 8
+	p.ManAuthor = "Written by the `TestMan' authors."
+	p.ManSeeAlso = []string{"git(1)", "ssh(1)"}
+	p.ManBugs = "Report bugs to the issue tracker."
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	got := buf.String()
+
+	tt := time.Now()
+
+	expected := fmt.Sprintf(`.TH TestMan 8 "%s"
+.SH NAME
+TestMan \- Test manpage generation
+.SH SYNOPSIS
+\fBTestMan\fP [OPTIONS]
+.SH DESCRIPTION
+
+.SH OPTIONS
+.SS Application Options
+.TP
+\fB\fB\-v\fR\fP
+Verbose output
+.SH AUTHOR
+Written by the \fBTestMan\fP authors.
+.SH SEE ALSO
+git(1),
+ssh(1)
+.SH BUGS
+Report bugs to the issue tracker.
+`, tt.Format("2 January 2006"))
+
+	assertDiff(t, got, expected, "man page")
+}
+
+func TestManCommandSections(t *testing.T) {
+	var opts struct {
+		Command struct{} `command:"command" description:"A command"`
+		Other   struct{} `command:"other" description:"Another command"`
+	}
+
+	p := NewNamedParser("TestMan", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	p.Find("command").LongDescription = "Introduction of the `command'.\n\n## Examples\nFirst example\ncontinued.\n\nSecond example.\n## See Also\nOther commands"
+	p.Find("other").LongDescription = "A plain description.\n\nWith two paragraphs."
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	expected := `.SS command
+A command
+
+Introduction of the \fBcommand\fP.
+.SS Examples
+First example
+continued.
+.PP
+Second example.
+.SS See Also
+Other commands
+.SS other
+Another command
+
+A plain description.
+
+With two paragraphs.
+`
+
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected man page to contain:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestManWrap(t *testing.T) {
+	var opts struct {
+		Hosts []string `long:"host" description:"A host to connect to. This option can be specified multiple times to connect to several hosts at once" default:"alpha.example.com" default:"beta.example.com" default:"gamma.example.com" default:"delta.example.com"`
+	}
+
+	p := NewNamedParser("TestMan", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	expected := `.TP
+\fB\fB\-\-host\fR\fP
+A host to connect to. This option can be specified multiple
+times to connect to several hosts at once
+<default: \fI"alpha.example.com", "beta.example.com", "gamma.example.com",
+"delta.example.com"\fR>
+`
+
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected man page to contain:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestManEscape(t *testing.T) {
+	var opts struct {
+		Value string `long:"value" description:".start with a period\n'and an apostrophe" default:"-1"`
+	}
+
+	p := NewNamedParser("test-man", None)
+	p.ShortDescription = "Escape back\\slashes"
+	p.LongDescription = ".TH not a header\n'also not a request"
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	got := buf.String()
+
+	expected := []string{
+		"test\\-man \\- Escape back\\\\slashes\n",
+		"\\&.TH not a header\n\\&'also not a request\n",
+		"\\fB\\fB\\-\\-value\\fR <default: \\fI\"\\-1\"\\fR>\\fP\n",
+		"\\&.start with a period\n\\&'and an apostrophe\n",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(got, e) {
+			t.Errorf("Expected man page to contain:\n%s\nbut got:\n%s", e, got)
+		}
+	}
+
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, ".TH not") || strings.HasPrefix(line, "'") {
+			t.Errorf("Unexpected unescaped control line %q", line)
+		}
+	}
+}
+
 type helpCommandNoOptions struct {
 	Command struct {
 	} `command:"command" description:"A command"`
@@ -434,6 +577,72 @@ Long hidden command description
 	}
 }
 
+func TestHelpHideHelpGroup(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+	}
+
+	p := NewNamedParser("TestHelpHideHelpGroup", HelpFlag)
+	p.ShowHelpGroup = false
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"--help"})
+
+	if !isErrorType(err, ErrHelp) {
+		t.Fatalf("Expected ErrHelp, but got %v", err)
+	}
+
+	msg := err.(*Error).Message
+
+	if strings.Contains(msg, "Help Options") {
+		t.Errorf("Expected help not to contain the help group, but got:\n%s", msg)
+	}
+
+	if !strings.Contains(msg, "Application Options") {
+		t.Errorf("Expected help to contain the application options, but got:\n%s", msg)
+	}
+}
+
+type localizedOptions struct {
+	Verbose bool `short:"v" long:"verbose" description:"Show verbose output"`
+	Quiet   bool `short:"q" long:"quiet" description:"Show less output"`
+}
+
+func (o *localizedOptions) OptionDescription(longName string) (string, bool) {
+	if longName == "verbose" {
+		return "Ausführliche Ausgabe anzeigen", true
+	}
+
+	return "", false
+}
+
+func TestHelpDescriptionProvider(t *testing.T) {
+	var opts localizedOptions
+
+	p := NewNamedParser("TestHelpDescriptionProvider", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	for _, s := range []string{"Ausführliche Ausgabe anzeigen\n", "Show less output\n"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected help to contain %q, but got:\n%s", s, buf.String())
+		}
+	}
+
+	if strings.Contains(buf.String(), "Show verbose output") {
+		t.Errorf("Expected the description tag to be replaced, but got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	if !strings.Contains(buf.String(), "Ausführliche Ausgabe anzeigen\n") {
+		t.Errorf("Expected man page to contain the provided description, but got:\n%s", buf.String())
+	}
+}
+
 func TestHelpDefaults(t *testing.T) {
 	var expected string
 
@@ -510,6 +719,35 @@ Help Options:
 	}
 }
 
+func TestHelpEmptyDefault(t *testing.T) {
+	var opts struct {
+		Empty string `long:"empty" default:"" description:"Empty default"`
+		None  string `long:"none" description:"No default"`
+	}
+
+	p := NewNamedParser("TestHelpEmptyDefault", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "Empty default (default: \"\")\n") {
+		t.Errorf("Expected the empty default to be shown, but got:\n%s", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "No default (default:") {
+		t.Errorf("Expected no default to be shown, but got:\n%s", buf.String())
+	}
+
+	if !p.FindOptionByLongName("empty").HasDefault() || p.FindOptionByLongName("none").HasDefault() {
+		t.Errorf("Expected only the empty option to have a default")
+	}
+}
+
 func TestHelpRestArgs(t *testing.T) {
 	opts := struct {
 		Verbose bool `short:"v"`
@@ -527,6 +765,100 @@ func TestHelpRestArgs(t *testing.T) {
 	assertStringArray(t, retargs, []string{"-v", "rest"})
 }
 
+func TestHelpArgsDescription(t *testing.T) {
+	var opts struct {
+		Positional struct {
+			Source string   `positional-arg-name:"source" description:"The source"`
+			Rest   []string `positional-arg-name:"rest" description:"Remaining files"`
+		} `positional-args:"yes" description:"The files to copy"`
+	}
+
+	p := NewNamedParser("TestHelpArgsDescription", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := "\nArguments:\n  The files to copy\n  source:"
+
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected help to contain:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+
+	var cmdOpts struct {
+		Command struct {
+			Positional struct {
+				Target string `positional-arg-name:"target" description:"The target"`
+			} `positional-args:"yes" description:"Where to put the files"`
+		} `command:"command"`
+	}
+
+	p = NewNamedParser("TestHelpArgsDescription", None)
+	p.AddGroup("Application Options", "", &cmdOpts)
+
+	if _, err := p.ParseArgs([]string{"command"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	expected = "\n[command command arguments]\n  Where to put the files\n  target:"
+
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected help to contain:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestHelpEpilogue(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" description:"Verbose output"`
+
+		Command struct {
+		} `command:"command" description:"A command"`
+	}
+
+	p := NewNamedParser("TestHelpEpilogue", None)
+	p.AddGroup("Application Options", "", &opts)
+	p.Epilogue = "Documentation: https://example.com/docs"
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := "  command  A command\n\nDocumentation: https://example.com/docs\n"
+
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("Expected help to end with:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+
+	p.Find("command").Epilogue = "See also the other commands."
+
+	if _, err := p.ParseArgs([]string{"command"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	expected = "\n\nSee also the other commands.\n\nDocumentation: https://example.com/docs\n"
+
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("Expected help to end with:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	for _, expected := range []string{
+		".PP\nDocumentation: https://example.com/docs\n.SH OPTIONS\n",
+		".PP\nSee also the other commands.\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected man page to contain:\n%s\nbut got:\n%s", expected, buf.String())
+		}
+	}
+}
+
 func TestWrapText(t *testing.T) {
 	s := "Lorem ipsum dolor sit amet, consectetur adipisicing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum."
 
@@ -567,6 +899,23 @@ func TestWrapParagraph(t *testing.T) {
 	assertDiff(t, got, expected, "wrapped paragraph")
 }
 
+func TestWrapPreformatted(t *testing.T) {
+	s := "Lorem ipsum dolor sit amet, consectetur adipisicing elit, sed do eiusmod tempor incididunt ut labore.\n"
+	s += "\tmode   | description of the mode, which is longer than the width\n"
+	s += "\tauto   | automatic\n"
+	s += "Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris."
+
+	got := wrapText(s, 60, "      ")
+	expected := `Lorem ipsum dolor sit amet, consectetur adipisicing elit,
+      sed do eiusmod tempor incididunt ut labore.
+          mode   | description of the mode, which is longer than the width
+          auto   | automatic
+      Ut enim ad minim veniam, quis nostrud exercitation ullamco
+      laboris.`
+
+	assertDiff(t, got, expected, "wrapped text")
+}
+
 func TestHelpDefaultMask(t *testing.T) {
 	var tests = []struct {
 		opts    interface{}
@@ -629,6 +978,208 @@ func TestHelpDefaultMask(t *testing.T) {
 	}
 }
 
+func TestHelpMaskDefaults(t *testing.T) {
+	var tests = []struct {
+		opts    interface{}
+		present string
+	}{
+		{
+			opts: &struct {
+				Value string `short:"v" default:"123" description:"V"`
+			}{},
+			present: "V (default: ***)\n",
+		},
+		{
+			opts: &struct {
+				Value string `short:"v" description:"V"`
+			}{Value: "123"},
+			present: "V (default: ***)\n",
+		},
+		{
+			opts: &struct {
+				Value string `short:"v" description:"V"`
+			}{},
+			present: "V\n",
+		},
+		{
+			opts: &struct {
+				Value string `short:"v" default:"123" default-mask:"abc" description:"V"`
+			}{},
+			present: "V (default: abc)\n",
+		},
+		{
+			opts: &struct {
+				Value string `short:"v" default:"123" default-mask:"-" description:"V"`
+			}{},
+			present: "V\n",
+		},
+	}
+
+	for _, test := range tests {
+		p := NewParser(test.opts, None)
+		p.MaskDefaults = true
+
+		if _, err := p.ParseArgs(nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		h := &bytes.Buffer{}
+		w := bufio.NewWriter(h)
+		p.writeHelpOption(w, p.FindOptionByShortName('v'), p.getAlignmentInfo())
+		w.Flush()
+
+		if !strings.HasSuffix(h.String(), test.present) {
+			t.Errorf("Not present %q\n%s", test.present, h.String())
+		}
+	}
+}
+
+func TestHelpExperimental(t *testing.T) {
+	var opts = struct {
+		Value   string `long:"value" description:"Value"`
+		Preview string `long:"preview" default:"on" description:"Preview feature" experimental:"yes"`
+	}{}
+
+	p := NewNamedParser("TestHelpExperimental", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"--preview", "off"})
+	assertError(t, err, ErrExperimental, "flag `"+defaultLongOptDelimiter+"preview' is experimental and not enabled")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if strings.Contains(b.String(), "preview") {
+		t.Errorf("Expected experimental option to be hidden in the help:\n%s", b.String())
+	}
+
+	p.AllowExperimental = true
+
+	if _, err := p.ParseArgs([]string{"--preview", "off"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Preview, "off")
+
+	b.Reset()
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "Preview feature (experimental) (default: on)\n") {
+		t.Errorf("Expected experimental option to be marked in the help:\n%s", b.String())
+	}
+}
+
+func TestHelpCompact(t *testing.T) {
+	var opts = struct {
+		Format string `long:"format" summary:"Output format" description:"Output format, either json for machine readable output or text"`
+		Quiet  bool   `long:"quiet" description:"Be quiet"`
+	}{}
+
+	p := NewNamedParser("TestHelpCompact", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "Output format, either json") {
+		t.Errorf("Expected the description in the help:\n%s", b.String())
+	}
+
+	p.CompactHelp = true
+
+	b.Reset()
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "Output format\n") || strings.Contains(b.String(), "either json") {
+		t.Errorf("Expected the summary in the compact help:\n%s", b.String())
+	}
+
+	if !strings.Contains(b.String(), "Be quiet\n") {
+		t.Errorf("Expected the description of an option without summary:\n%s", b.String())
+	}
+
+	b.Reset()
+	p.WriteManPage(&b)
+
+	if !strings.Contains(b.String(), "either json") {
+		t.Errorf("Expected the description in the man page:\n%s", b.String())
+	}
+}
+
+func TestHelpCommandWrap(t *testing.T) {
+	p := NewNamedParser("TestHelpCommandWrap", None)
+
+	p.AddCommand("short", "A short description", "", &struct{}{})
+	p.AddCommand("wrapped", strings.Repeat("A long command description that wraps. ", 5), "", &struct{}{})
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	cols := p.getAlignmentInfo().TerminalColumns
+	lines := strings.Split(b.String(), "\n")
+
+	found := false
+
+	for i, line := range lines {
+		if len(line) > cols {
+			t.Errorf("Expected line to fit in %d columns, but got %q", cols, line)
+		}
+
+		if strings.HasPrefix(line, "  wrapped  A long") {
+			found = true
+
+			indent := strings.Repeat(" ", 11)
+
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], indent) || strings.HasPrefix(lines[i+1], indent+" ") {
+				t.Errorf("Expected an indented continuation line, but got:\n%s", b.String())
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("Expected the wrapped command in the help:\n%s", b.String())
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	var opts = struct {
+		Verbose bool `short:"v" long:"verbose" description:"Verbose output"`
+	}{}
+
+	p := NewNamedParser("TestVersionFlag", HelpFlag|VersionFlag)
+	p.Version = "1.2.3"
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"--version", "--unknown"})
+	assertError(t, err, ErrVersion, "1.2.3")
+
+	var b bytes.Buffer
+	p.WriteHelp(&b)
+
+	if !strings.Contains(b.String(), "Version Options:\n") || !strings.Contains(b.String(), defaultLongOptDelimiter+"version") {
+		t.Errorf("Expected the version option in the help:\n%s", b.String())
+	}
+
+	if !strings.Contains(b.String(), "Usage:\n  TestVersionFlag [OPTIONS]\n") {
+		t.Errorf("Expected the usage to mention options:\n%s", b.String())
+	}
+
+	var own = struct {
+		Version bool `long:"version"`
+	}{}
+
+	p = NewNamedParser("TestVersionFlag", VersionFlag)
+	p.AddGroup("Application Options", "", &own)
+
+	if _, err := p.ParseArgs([]string{"--version"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !own.Version {
+		t.Errorf("Expected the own version option to be set")
+	}
+}
+
 func TestWroteHelp(t *testing.T) {
 	type testInfo struct {
 		value  error
@@ -650,3 +1201,378 @@ func TestWroteHelp(t *testing.T) {
 		})
 	}
 }
+
+func TestHelpCommandCategories(t *testing.T) {
+	var opts struct {
+		Status struct{} `command:"status" description:"Show the status" category:"Porcelain"`
+		Misc   struct{} `command:"misc" description:"Miscellaneous"`
+		Commit struct{} `command:"commit" description:"Record changes" category:"Porcelain"`
+		Hash   struct{} `command:"hash-object" description:"Compute an object hash" category:"Plumbing"`
+		Add    struct{} `command:"add" description:"Add files" category:"Porcelain"`
+	}
+
+	p := NewNamedParser("TestHelpCommandCategories", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	expected := `Usage:
+  TestHelpCommandCategories <command>
+
+Available commands:
+  misc         Miscellaneous
+
+Porcelain:
+  status       Show the status
+  commit       Record changes
+  add          Add files
+
+Plumbing:
+  hash-object  Compute an object hash
+`
+
+	assertDiff(t, buf.String(), expected, "help message")
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	man := buf.String()
+
+	for _, section := range []string{".SH COMMANDS\n.SS misc", ".SH PORCELAIN\n.SS status", ".SH PLUMBING\n.SS hash\\-object"} {
+		if !strings.Contains(man, section) {
+			t.Errorf("Expected man page to contain %q, but got:\n%s", section, man)
+		}
+	}
+}
+
+func TestHelpGroupPriority(t *testing.T) {
+	var opts struct {
+		Output struct {
+			Format string `long:"format" description:"Output format"`
+		} `group:"Output Options"`
+
+		Network struct {
+			Host string `long:"host" description:"Host name"`
+		} `group:"Network Options" help-priority:"1"`
+
+		Common struct {
+			Verbose bool `long:"verbose" description:"Verbose output"`
+		} `group:"Common Options" help-priority:"-1"`
+	}
+
+	p := NewNamedParser("TestHelpGroupPriority", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	help := buf.String()
+
+	common := strings.Index(help, "Common Options:")
+	output := strings.Index(help, "Output Options:")
+	network := strings.Index(help, "Network Options:")
+
+	if common < 0 || output < 0 || network < 0 {
+		t.Fatalf("Expected all groups in help, but got:\n%s", help)
+	}
+
+	if !(common < output && output < network) {
+		t.Errorf("Expected groups ordered by priority, but got:\n%s", help)
+	}
+}
+
+func TestAlignmentInfo(t *testing.T) {
+	var opts struct {
+		Verbose bool   `short:"v" long:"verbose" description:"Verbose output"`
+		File    string `long:"file" value-name:"FILE" description:"A file"`
+	}
+
+	p := NewNamedParser("TestAlignmentInfo", None)
+	p.AddGroup("Application Options", "The application options", &opts)
+
+	info := p.AlignmentInfo()
+
+	if !info.HasShort || !info.HasValueName {
+		t.Errorf("Expected short names and value names, but got %#v", info)
+	}
+
+	if info.MaxLongLen != len("fileFILE") {
+		t.Errorf("Expected max long length %d, but got %d", len("fileFILE"), info.MaxLongLen)
+	}
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasSuffix(line, "Verbose output") {
+			if col := strings.Index(line, "Verbose output"); col != info.DescriptionStart() {
+				t.Errorf("Expected description at column %d, but got %d", info.DescriptionStart(), col)
+			}
+
+			if col := len(line) - len(strings.TrimLeft(line, " ")); col != info.OptionStart() {
+				t.Errorf("Expected option at column %d, but got %d", info.OptionStart(), col)
+			}
+		}
+	}
+}
+
+func TestHelpHideSubcommands(t *testing.T) {
+	var opts struct {
+		Remote struct {
+			Add struct {
+				Name string `long:"name" description:"The remote name"`
+
+				Mirror struct {
+				} `command:"mirror" description:"Add a mirror"`
+			} `command:"add" description:"Add a remote"`
+
+			Remove struct {
+			} `command:"remove" description:"Remove a remote"`
+		} `command:"remote" description:"Manage remotes" hide-subcommands:"yes"`
+
+		Status struct {
+		} `command:"status" description:"Show the status"`
+	}
+
+	p := NewNamedParser("TestHelpHideSubcommands", HelpFlag)
+	p.AddGroup("Application Options", "", &opts)
+
+	_, err := p.ParseArgs([]string{"remote", "--help"})
+
+	if !WroteHelp(err) {
+		t.Fatalf("Expected help error, but got %v", err)
+	}
+
+	if !strings.HasPrefix(err.Error(), "Usage:\n  TestHelpHideSubcommands [OPTIONS] remote\n") {
+		t.Errorf("Expected usage without subcommands, but got:\n%s", err)
+	}
+
+	if strings.Contains(err.Error(), "Available commands") {
+		t.Errorf("Expected help without subcommands, but got:\n%s", err)
+	}
+
+	var buf bytes.Buffer
+	p.WriteManPage(&buf)
+
+	man := buf.String()
+
+	if !strings.Contains(man, ".SS remote\n") {
+		t.Errorf("Expected man page to contain the remote command, but got:\n%s", man)
+	}
+
+	for _, name := range []string{"remote add", "remote remove", "remote add mirror"} {
+		if strings.Contains(man, ".SS "+name+"\n") {
+			t.Errorf("Expected man page not to contain the %s command, but got:\n%s", name, man)
+		}
+	}
+
+	c := &completion{parser: p}
+
+	ret := c.complete([]string{"remote", ""})
+
+	if len(ret) != 0 {
+		t.Errorf("Expected no completions for hidden subcommands, but got %v", ret)
+	}
+
+	// Hidden subcommands can still be invoked, including their help
+	_, err = p.ParseArgs([]string{"remote", "add", "--help"})
+
+	if !WroteHelp(err) {
+		t.Fatalf("Expected help error, but got %v", err)
+	}
+
+	if !strings.HasPrefix(err.Error(), "Usage:\n  TestHelpHideSubcommands [OPTIONS] remote add [add-OPTIONS] <mirror>\n") {
+		t.Errorf("Expected usage of the add command, but got:\n%s", err)
+	}
+}
+
+func TestWriteHelpFor(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+
+		Deploy struct {
+			Force bool `short:"f" long:"force" description:"Force the deployment"`
+
+			Rollback struct {
+				Steps int `long:"steps" description:"Number of steps"`
+			} `command:"rollback" description:"Roll back a deployment"`
+		} `command:"deploy" alias:"d" description:"Deploy the application"`
+
+		Status struct {
+		} `command:"status" description:"Show the status"`
+	}
+
+	p := NewNamedParser("TestWriteHelpFor", None)
+	p.AddGroup("Application Options", "", &opts)
+
+	var full, scoped bytes.Buffer
+
+	if _, err := p.ParseArgs([]string{"deploy", "rollback"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p.WriteHelp(&full)
+
+	if err := p.WriteHelpFor(&scoped, "d", "rollback"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertDiff(t, scoped.String(), full.String(), "help message")
+
+	// The active commands are restored
+	if p.Active == nil || p.Active.Name != "deploy" || p.Active.Active == nil || p.Active.Active.Name != "rollback" {
+		t.Errorf("Expected active commands to be restored")
+	}
+
+	scoped.Reset()
+
+	if err := p.WriteHelpFor(&scoped, "deploy"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	help := scoped.String()
+
+	if !strings.Contains(help, "Force the deployment") || !strings.Contains(help, "rollback  Roll back a deployment") {
+		t.Errorf("Expected help of the deploy command, but got:\n%s", help)
+	}
+
+	if strings.Contains(help, "Number of steps") || strings.Contains(help, "Show the status") {
+		t.Errorf("Expected help to be scoped to the deploy command, but got:\n%s", help)
+	}
+
+	scoped.Reset()
+
+	if err := p.WriteHelpFor(&scoped, "deploy", defaultLongOptDelimiter+"force"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasSuffix(scoped.String(), "Force the deployment\n") || strings.Contains(scoped.String(), "Usage") {
+		t.Errorf("Expected help of the force option, but got:\n%s", scoped.String())
+	}
+
+	scoped.Reset()
+
+	if err := p.WriteHelpFor(&scoped, "verbose"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasSuffix(scoped.String(), "Show verbose debug information\n") {
+		t.Errorf("Expected help of the verbose option, but got:\n%s", scoped.String())
+	}
+
+	scoped.Reset()
+
+	err := p.WriteHelpFor(&scoped, "deploy", "unknown")
+	assertError(t, err, ErrUnknownCommand, "Unknown command `unknown'")
+
+	err = p.WriteHelpFor(&scoped, "deploy", defaultLongOptDelimiter+"unknown")
+	assertError(t, err, ErrUnknownFlag, "unknown flag `unknown'")
+
+	err = p.WriteHelpFor(&scoped, "unknown", "rollback")
+	assertError(t, err, ErrUnknownCommand, "Unknown command `unknown'")
+
+	if scoped.Len() != 0 {
+		t.Errorf("Expected nothing to be written for unknown paths, but got:\n%s", scoped.String())
+	}
+}
+
+func TestWriteUsageLine(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose"`
+
+		Add struct {
+			Force bool `long:"force"`
+
+			Positional struct {
+				File string `positional-arg-name:"file" required:"yes"`
+			} `positional-args:"yes"`
+		} `command:"add"`
+
+		Remove struct {
+		} `command:"rm"`
+	}
+
+	p := NewNamedParser("TestWriteUsageLine", HelpFlag)
+	p.AddGroup("Application Options", "", &opts)
+
+	var buf bytes.Buffer
+	p.WriteUsageLine(&buf)
+
+	assertString(t, buf.String(), "Usage: TestWriteUsageLine [OPTIONS] <add | rm>\n")
+
+	if _, err := p.ParseArgs([]string{"add", "file"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	p.WriteUsageLine(&buf)
+
+	assertString(t, buf.String(), "Usage: TestWriteUsageLine [OPTIONS] add [add-OPTIONS] file\n")
+}
+
+func TestHelpSortOptions(t *testing.T) {
+	var opts struct {
+		Zulu  bool `long:"zulu" description:"Zulu"`
+		Bravo bool `short:"x" description:"Bravo"`
+		Alpha bool `short:"z" long:"alpha" description:"Alpha"`
+		Yank  bool `short:"a" description:"Yank"`
+		Mike  bool `long:"mike" description:"Mike"`
+
+		Positional struct {
+			Second string `positional-arg-name:"second" description:"Second"`
+			First  string `positional-arg-name:"first" description:"First"`
+		} `positional-args:"yes"`
+	}
+
+	p := NewNamedParser("TestHelpSortOptions", None)
+	p.AddGroup("Application Options", "", &opts)
+	p.SortOptions = true
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	help := buf.String()
+
+	order := func(s string, items []string) []int {
+		ret := make([]int, len(items))
+
+		for i, item := range items {
+			ret[i] = strings.Index(s, item)
+		}
+
+		return ret
+	}
+
+	isSorted := func(indices []int) bool {
+		for i, idx := range indices {
+			if idx < 0 || (i > 0 && idx < indices[i-1]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !isSorted(order(help, []string{"Alpha", "Mike", "Zulu", "Yank", "Bravo", "Second", "First"})) {
+		t.Errorf("Expected sorted options and unsorted arguments, but got:\n%s", help)
+	}
+
+	buf.Reset()
+	p.WriteManPage(&buf)
+
+	man := buf.String()
+
+	if !isSorted(order(man, []string{"Alpha", "Mike", "Zulu", "Yank", "Bravo"})) {
+		t.Errorf("Expected sorted options in man page, but got:\n%s", man)
+	}
+
+	p.SortOptions = false
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	if !isSorted(order(buf.String(), []string{"Zulu", "Bravo", "Alpha", "Yank", "Mike"})) {
+		t.Errorf("Expected options in declaration order, but got:\n%s", buf.String())
+	}
+}
@@ -1,6 +1,10 @@
 package flags
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -72,3 +76,537 @@ func TestLongOptionalArgEqual(t *testing.T) {
 	assertStringArray(t, ret, []string{"no"})
 	assertString(t, opts.Value, "value")
 }
+
+func TestLongOptionalValueImplied(t *testing.T) {
+	var tests = []struct {
+		args     []string
+		expected string
+		rest     []string
+	}{
+		{[]string{"--color"}, "auto", []string{}},
+		{[]string{"--color", "never"}, "auto", []string{"never"}},
+		{[]string{"--color=never"}, "never", []string{}},
+		{[]string{"-c"}, "auto", []string{}},
+		{[]string{"-fc", "never"}, "auto", []string{"never"}},
+		{[]string{"-cnever"}, "never", []string{}},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			F     bool   `short:"f"`
+			Color string `short:"c" long:"color" optional-value:"auto"`
+		}{}
+
+		ret := assertParseSuccess(t, &opts, test.args...)
+
+		assertStringArray(t, ret, test.rest)
+		assertString(t, opts.Color, test.expected)
+	}
+}
+
+func TestLongBoolValues(t *testing.T) {
+	var tests = []struct {
+		args     []string
+		expected bool
+		rest     []string
+	}{
+		{[]string{"--value"}, true, []string{}},
+		{[]string{"--value=false"}, false, []string{}},
+		{[]string{"--value=yes"}, true, []string{}},
+		{[]string{"--value", "0"}, false, []string{}},
+		{[]string{"--value", "no", "arg"}, false, []string{"arg"}},
+		{[]string{"--value", "arg"}, true, []string{"arg"}},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			Value bool `long:"value"`
+		}{}
+
+		p := NewParser(&opts, AllowBoolValues)
+		ret, err := p.ParseArgs(test.args)
+
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", test.args, err)
+		}
+
+		if opts.Value != test.expected {
+			t.Errorf("Expected Value to be %v for %v", test.expected, test.args)
+		}
+
+		assertStringArray(t, ret, test.rest)
+	}
+}
+
+func TestLongBoolValuesInvalid(t *testing.T) {
+	var opts = struct {
+		Value bool `long:"value"`
+	}{}
+
+	p := NewParser(&opts, AllowBoolValues)
+	_, err := p.ParseArgs([]string{"--value=maybe"})
+
+	if e, ok := err.(*Error); !ok || e.Type != ErrMarshal {
+		t.Errorf("Expected ErrMarshal, but got %v", err)
+	}
+}
+
+func TestLongBoolValuesSlice(t *testing.T) {
+	var opts = struct {
+		Value []bool `short:"v" long:"value"`
+	}{}
+
+	p := NewParser(&opts, AllowBoolValues)
+	ret, err := p.ParseArgs([]string{"-vv", "--value", "true"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertBoolArray(t, opts.Value, []bool{true, true, true})
+	assertStringArray(t, ret, []string{"true"})
+}
+
+func TestLongGreedy(t *testing.T) {
+	var opts = struct {
+		Include []string `long:"include" greedy:"yes"`
+		Value   bool     `short:"v"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "--include", "a", "b", "c", "-v", "d", "--include", "e", "--", "f")
+
+	assertStringArray(t, opts.Include, []string{"a", "b", "c", "e"})
+	assertStringArray(t, ret, []string{"d", "f"})
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+}
+
+func TestLongGreedyEqual(t *testing.T) {
+	var opts = struct {
+		Include []string `long:"include" greedy:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "--include=a", "b")
+
+	assertStringArray(t, opts.Include, []string{"a"})
+	assertStringArray(t, ret, []string{"b"})
+}
+
+func TestLongAllowDashValue(t *testing.T) {
+	var opts = struct {
+		Pattern string `long:"pattern" allow-dash-value:"yes"`
+		Value   bool   `short:"x"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "--pattern", "-x")
+
+	assertStringArray(t, ret, []string{})
+	assertString(t, opts.Pattern, "-x")
+
+	if opts.Value {
+		t.Errorf("Expected Value to be false")
+	}
+
+	assertParseSuccess(t, &opts, "--pattern=-x")
+	assertString(t, opts.Pattern, "-x")
+}
+
+func TestLongDashValue(t *testing.T) {
+	var opts = struct {
+		Pattern string `long:"pattern"`
+		Value   bool   `short:"x"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--pattern=-x")
+	assertString(t, opts.Pattern, "-x")
+
+	assertParseFail(t, ErrExpectedArgument, "expected argument for flag `"+defaultLongOptDelimiter+"pattern', but got option `-x'", &opts, "--pattern", "-x")
+}
+
+func TestLongAbsPath(t *testing.T) {
+	var opts = struct {
+		Path  string   `long:"path" abs-path:"yes"`
+		Paths []string `long:"paths" abs-path:"yes"`
+		Other string   `long:"other"`
+	}{}
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abs := filepath.Join(cwd, "abs")
+
+	assertParseSuccess(t, &opts, "--path", "a", "--paths", "b", "--paths", abs, "--other", "c")
+
+	assertString(t, opts.Path, filepath.Join(cwd, "a"))
+	assertStringArray(t, opts.Paths, []string{filepath.Join(cwd, "b"), abs})
+	assertString(t, opts.Other, "c")
+
+	assertParseSuccess(t, &opts, "--path=")
+	assertString(t, opts.Path, "")
+}
+
+func TestLongAbsPathInvalidType(t *testing.T) {
+	var opts = struct {
+		Path int `long:"path" abs-path:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "abs-path flag `path' must be a string or a slice of strings", &opts)
+}
+
+func TestLongMinMax(t *testing.T) {
+	var tests = []struct {
+		args []string
+		typ  ErrorType
+		msg  string
+	}{
+		{[]string{}, ErrRequired, "the flag `" + defaultLongOptDelimiter + "tag' must be specified at least 1 times"},
+		{[]string{"--tag", "a"}, 0, ""},
+		{[]string{"--tag", "a", "--tag", "b", "--tag", "c"}, 0, ""},
+		{[]string{"--tag", "a", "--tag", "b", "--tag", "c", "--tag", "d"}, ErrTooMany, "the flag `" + defaultLongOptDelimiter + "tag' can be specified at most 3 times"},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			Tags []string `long:"tag" min:"1" max:"3" default:"x"`
+		}{
+			Tags: []string{"x"},
+		}
+
+		if test.msg == "" {
+			assertParseSuccess(t, &opts, test.args...)
+
+			var values []string
+
+			for i := 1; i < len(test.args); i += 2 {
+				values = append(values, test.args[i])
+			}
+
+			assertStringArray(t, opts.Tags, values)
+		} else {
+			assertParseFail(t, test.typ, test.msg, &opts, test.args...)
+		}
+	}
+}
+
+func TestLongMinMaxInvalid(t *testing.T) {
+	var notSlice = struct {
+		Tag string `long:"tag" min:"1"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "min flag `tag' must be a slice", &notSlice)
+
+	var invalid = struct {
+		Tags []string `long:"tag" max:"many"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "invalid max `many' for flag `tag'", &invalid)
+
+	var reversed = struct {
+		Tags []string `long:"tag" min:"3" max:"1"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "max of flag `tag' must not be less than its min", &reversed)
+}
+
+func TestLongClearable(t *testing.T) {
+	var opts = struct {
+		List   []string          `long:"list" clearable:"yes"`
+		Values map[string]string `long:"value" clearable:"yes"`
+		Other  []string          `long:"other"`
+	}{
+		List:   []string{"a"},
+		Values: map[string]string{"a": "b"},
+	}
+
+	assertParseSuccess(t, &opts, "--list=", "--value=", "--other=")
+
+	if opts.List == nil || len(opts.List) != 0 {
+		t.Errorf("Expected List to be empty, but got %#v", opts.List)
+	}
+
+	if opts.Values == nil || len(opts.Values) != 0 {
+		t.Errorf("Expected Values to be empty, but got %#v", opts.Values)
+	}
+
+	assertStringArray(t, opts.Other, []string{""})
+
+	assertParseSuccess(t, &opts, "--list=", "--list=b", "--value=", "--value=c:d")
+
+	assertStringArray(t, opts.List, []string{"b"})
+
+	if len(opts.Values) != 1 || opts.Values["c"] != "d" {
+		t.Errorf("Expected Values to be map[c:d], but got %#v", opts.Values)
+	}
+}
+
+func TestLongClearableInvalidType(t *testing.T) {
+	var opts = struct {
+		List string `long:"list" clearable:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "clearable flag `list' must be a slice or a map", &opts)
+}
+
+func TestLongAppendOperator(t *testing.T) {
+	var opts = struct {
+		List   []string          `short:"l" long:"list" append-operator:"yes"`
+		Values map[string]string `long:"value" append-operator:"yes"`
+	}{}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{}, []string{"a", "b"}},
+		{[]string{"--list+=c"}, []string{"a", "b", "c"}},
+		{[]string{"--list=c"}, []string{"c"}},
+		{[]string{"--list", "c", "--list+=d"}, []string{"c", "d"}},
+		{[]string{"--list+=c", "--list=d", "--list+=e"}, []string{"d", "e"}},
+		{[]string{"--list+=c", "-l", "d"}, []string{"d"}},
+	}
+
+	for _, test := range tests {
+		// Values set before parsing, e.g. from a configuration file
+		opts.List = []string{"a", "b"}
+		opts.Values = map[string]string{"a": "b"}
+
+		assertParseSuccess(t, &opts, test.args...)
+		assertStringArray(t, opts.List, test.expected)
+	}
+
+	assertParseSuccess(t, &opts, "--value+=c:d")
+
+	if len(opts.Values) != 2 || opts.Values["a"] != "b" || opts.Values["c"] != "d" {
+		t.Errorf("Expected Values to be map[a:b c:d], but got %#v", opts.Values)
+	}
+
+	opts.Values = map[string]string{"a": "b"}
+	assertParseSuccess(t, &opts, "--value=c:d")
+
+	if len(opts.Values) != 1 || opts.Values["c"] != "d" {
+		t.Errorf("Expected Values to be map[c:d], but got %#v", opts.Values)
+	}
+}
+
+func TestLongAppendOperatorInvalid(t *testing.T) {
+	var opts = struct {
+		Value string `long:"value" append-operator:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "append-operator flag `value' must be a slice or a map", &opts)
+
+	var other = struct {
+		List []string `long:"list"`
+	}{}
+
+	assertParseFail(t, ErrUnknownFlag, "unknown flag `list+'", &other, "--list+=a")
+}
+
+func TestLongPrefixMatch(t *testing.T) {
+	var opts = struct {
+		Verbose   bool   `long:"verbose"`
+		Version   bool   `long:"version"`
+		Value     string `long:"value"`
+		Val       string `long:"val"`
+		Hidden    bool   `long:"verbatim" hidden:"yes"`
+		Namespace struct {
+			Name string `long:"name"`
+		} `group:"Namespace" namespace:"ns"`
+	}{}
+
+	p := NewParser(&opts, AllowPrefixMatch)
+
+	_, err := p.ParseArgs([]string{"--verb", "--vers", "--valu", "x", "--val", "y", "--ns.n", "z"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Verbose || !opts.Version {
+		t.Errorf("Expected Verbose and Version to be set")
+	}
+
+	assertString(t, opts.Value, "x")
+	assertString(t, opts.Val, "y")
+	assertString(t, opts.Namespace.Name, "z")
+
+	_, err = p.ParseArgs([]string{"--ver"})
+	assertError(t, err, ErrAmbiguousFlag, "ambiguous flag `ver' could be any of `verbose', `version'")
+
+	_, err = p.ParseArgs([]string{"--verba"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `verba'")
+
+	p = NewParser(&opts, None)
+
+	_, err = p.ParseArgs([]string{"--verb"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `verb'")
+}
+
+func TestLongMapDelim(t *testing.T) {
+	var opts = struct {
+		Env    map[string]string `long:"env" map-delim:"="`
+		Labels map[string]int    `long:"label"`
+	}{}
+
+	p, _ := assertParserSuccess(t, &opts, "--env=A=1=2", "--env", "B=", "--label=x:1", "--label", "y:2")
+
+	if len(opts.Env) != 2 || opts.Env["A"] != "1=2" || opts.Env["B"] != "" {
+		t.Errorf("Unexpected env: %#v", opts.Env)
+	}
+
+	if len(opts.Labels) != 2 || opts.Labels["x"] != 1 || opts.Labels["y"] != 2 {
+		t.Errorf("Unexpected labels: %#v", opts.Labels)
+	}
+
+	env := p.FindOptionByLongName("env")
+
+	assertString(t, env.ValueName, "key=value")
+	assertString(t, p.FindOptionByLongName("label").ValueName, "")
+
+	opts.Env = map[string]string{"A": "1"}
+	expectConvert(t, env, "{A=1}")
+}
+
+func TestLongMapDelimInvalid(t *testing.T) {
+	var opts = struct {
+		Env string `long:"env" map-delim:"="`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "map-delim flag `env' must be a map", &opts)
+}
+
+func TestLongSep(t *testing.T) {
+	var opts = struct {
+		List   []string `long:"list" sep:","`
+		Ports  []int    `short:"p" sep:","`
+		Values []string `long:"value"`
+	}{}
+
+	assertParseSuccess(t, &opts, "--list=a,b", "--list", "c", "-p", "80,443", "-p8080", "--value=x,y")
+
+	assertStringArray(t, opts.List, []string{"a", "b", "c"})
+	assertStringArray(t, opts.Values, []string{"x,y"})
+
+	if len(opts.Ports) != 3 || opts.Ports[0] != 80 || opts.Ports[1] != 443 || opts.Ports[2] != 8080 {
+		t.Errorf("Unexpected ports: %v", opts.Ports)
+	}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `-p' (expected []int): strconv.ParseInt: parsing \"x\": invalid syntax", &opts, "-p", "1,x")
+}
+
+func TestLongSepInvalid(t *testing.T) {
+	var opts = struct {
+		List string `long:"list" sep:","`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "sep flag `list' must be a slice", &opts)
+}
+
+func TestLongOS(t *testing.T) {
+	defer func(prev string) {
+		goos = prev
+	}(goos)
+
+	var opts = struct {
+		Sandbox bool `long:"sandbox" os:"linux, darwin" description:"Enable the sandbox"`
+		Verbose bool `long:"verbose" description:"Verbose output"`
+	}{}
+
+	goos = "linux"
+
+	p, _ := assertParserSuccess(t, &opts, "--sandbox")
+
+	if !opts.Sandbox {
+		t.Errorf("Expected Sandbox to be set")
+	}
+
+	assertStringArray(t, p.FindOptionByLongName("sandbox").OS, []string{"linux", "darwin"})
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), "Enable the sandbox") {
+		t.Errorf("Expected help to contain the option, but got:\n%s", buf.String())
+	}
+
+	goos = "windows"
+
+	assertParseFail(t, ErrUnknownFlag, "unknown flag `sandbox'", &opts, "--sandbox")
+
+	buf.Reset()
+	p.WriteHelp(&buf)
+
+	if strings.Contains(buf.String(), "Enable the sandbox") {
+		t.Errorf("Expected help not to contain the option, but got:\n%s", buf.String())
+	}
+}
+
+func TestLongSetter(t *testing.T) {
+	type server struct {
+		Host string
+		Port int
+	}
+
+	var opts struct {
+		Set struct {
+			Server  server
+			Backup  *server
+			Verbose bool
+			Tags    []string
+		} `long:"set" setter:"yes"`
+	}
+
+	ret := assertParseSuccess(t, &opts,
+		"--set", "server.host=localhost",
+		"--set", "Server.Port=8080",
+		"--set", "backup.port=9090",
+		"--set", "verbose=true",
+		"--set", "tags=a",
+		"--set", "tags=b",
+		"rest")
+
+	assertStringArray(t, ret, []string{"rest"})
+
+	assertString(t, opts.Set.Server.Host, "localhost")
+
+	if opts.Set.Server.Port != 8080 {
+		t.Errorf("Expected Server.Port to be 8080, but got %v", opts.Set.Server.Port)
+	}
+
+	if opts.Set.Backup == nil || opts.Set.Backup.Port != 9090 {
+		t.Errorf("Expected Backup.Port to be 9090, but got %v", opts.Set.Backup)
+	}
+
+	if !opts.Set.Verbose {
+		t.Errorf("Expected Verbose to be true")
+	}
+
+	assertStringArray(t, opts.Set.Tags, []string{"a", "b"})
+}
+
+func TestLongSetterErrors(t *testing.T) {
+	var opts struct {
+		Set struct {
+			Server struct {
+				Port int
+			}
+		} `long:"set" setter:"yes"`
+	}
+
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"set' (expected path=value): unknown path `server.host'", &opts, "--set", "server.host=localhost")
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"set' (expected path=value): expected path=value, but got `server'", &opts, "--set", "server")
+	assertParseFail(t, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"set' (expected path=value): strconv.ParseInt: parsing \"abc\": invalid syntax", &opts, "--set", "server.port=abc")
+}
+
+func TestLongSetterInvalidType(t *testing.T) {
+	var opts struct {
+		Set string `long:"set" setter:"yes"`
+	}
+
+	assertParseFail(t, ErrInvalidTag, "setter flag `set' must be a struct or a pointer to a struct", &opts)
+}
@@ -9,6 +9,11 @@ import (
 	"time"
 )
 
+// manTextWidth is the width at which option descriptions and defaults are
+// wrapped in the man page. It leaves room for the indentation of options in
+// an 80 column terminal.
+const manTextWidth = 65
+
 func manQuoteLines(s string) string {
 	lines := strings.Split(s, "\n")
 	parts := []string{}
@@ -20,44 +25,121 @@ func manQuoteLines(s string) string {
 	return strings.Join(parts, "\n")
 }
 
+// manQuote escapes s for use in troff. Backslashes and dashes are escaped
+// and a leading control character (a dot or an apostrophe) is protected by a
+// zero width character, so that user strings are always rendered as text.
 func manQuote(s string) string {
-	return strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "-", "\\-", -1)
+
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = "\\&" + s
+	}
+
+	return s
 }
 
 func formatForMan(wr io.Writer, s string, quoter func(s string) string) {
+	// Only the first part of s starts a line, so the control characters at
+	// the start of the other parts do not need to be protected
+	first := true
+
+	quote := func(s string) string {
+		q := quoter(s)
+
+		if !first {
+			q = strings.TrimPrefix(q, "\\&")
+		}
+
+		first = false
+		return q
+	}
+
 	for {
 		idx := strings.IndexRune(s, '`')
 
 		if idx < 0 {
-			fmt.Fprintf(wr, "%s", quoter(s))
+			fmt.Fprintf(wr, "%s", quote(s))
 			break
 		}
 
-		fmt.Fprintf(wr, "%s", quoter(s[:idx]))
+		fmt.Fprintf(wr, "%s", quote(s[:idx]))
 
 		s = s[idx+1:]
 		idx = strings.IndexRune(s, '\'')
 
 		if idx < 0 {
-			fmt.Fprintf(wr, "%s", quoter(s))
+			fmt.Fprintf(wr, "%s", quote(s))
 			break
 		}
 
-		fmt.Fprintf(wr, "\\fB%s\\fP", quoter(s[:idx]))
+		fmt.Fprintf(wr, "\\fB%s\\fP", quote(s[:idx]))
 		s = s[idx+1:]
 	}
 }
 
-func writeManPageOptions(wr io.Writer, grp *Group) {
-	grp.eachGroup(func(group *Group) {
-		if !group.showInHelp() {
+// manHeadingPrefix starts a line of a command long description which is
+// written as a subsection heading in the man page.
+const manHeadingPrefix = "## "
+
+func hasManHeadings(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, manHeadingPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeManSections writes a long description containing "## Heading" lines,
+// which start a subsection, and paragraphs separated by blank lines.
+func writeManSections(wr io.Writer, s string) {
+	var paragraph []string
+	separate := false
+
+	flush := func() {
+		if len(paragraph) == 0 {
 			return
 		}
 
+		if separate {
+			fmt.Fprintln(wr, ".PP")
+		}
+
+		formatForMan(wr, strings.Join(paragraph, "\n"), manQuoteLines)
+		fmt.Fprintln(wr, "")
+
+		paragraph = nil
+		separate = true
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, manHeadingPrefix) {
+			flush()
+
+			fmt.Fprintf(wr, ".SS %s\n", manQuote(strings.TrimSpace(line[len(manHeadingPrefix):])))
+			separate = false
+		} else if strings.TrimSpace(line) == "" {
+			flush()
+		} else {
+			paragraph = append(paragraph, line)
+		}
+	}
+
+	flush()
+}
+
+func (p *Parser) writeManPageOptions(wr io.Writer, grp *Group) {
+	for _, group := range grp.helpGroups() {
+		if !group.showInHelp() {
+			continue
+		}
+
 		// If the parent (grp) has any subgroups, display their descriptions as
 		// subsection headers similar to the output of --help.
 		if group.ShortDescription != "" && len(grp.groups) > 0 {
-			fmt.Fprintf(wr, ".SS %s\n", group.ShortDescription)
+			fmt.Fprintf(wr, ".SS %s\n", manQuote(group.ShortDescription))
 
 			if group.LongDescription != "" {
 				formatForMan(wr, group.LongDescription, manQuoteLines)
@@ -65,36 +147,50 @@ func writeManPageOptions(wr io.Writer, grp *Group) {
 			}
 		}
 
-		for _, opt := range group.options {
+		for _, opt := range p.helpOptions(group) {
 			if !opt.showInHelp() {
 				continue
 			}
 
+			// The rendered width of the tag, used to decide whether the
+			// defaults still fit on the tag line
+			tagWidth := 0
+
 			fmt.Fprintln(wr, ".TP")
 			fmt.Fprintf(wr, "\\fB")
 
 			if opt.ShortName != 0 {
 				fmt.Fprintf(wr, "\\fB\\-%c\\fR", opt.ShortName)
+				tagWidth += 2
 			}
 
 			if len(opt.LongName) != 0 {
 				if opt.ShortName != 0 {
 					fmt.Fprintf(wr, ", ")
+					tagWidth += 2
 				}
 
 				fmt.Fprintf(wr, "\\fB\\-\\-%s\\fR", manQuote(opt.LongNameWithNamespace()))
+				tagWidth += 2 + len(opt.LongNameWithNamespace())
 			}
 
 			if len(opt.ValueName) != 0 || opt.OptionalArgument {
 				if opt.OptionalArgument {
-					fmt.Fprintf(wr, " [\\fI%s=%s\\fR]", manQuote(opt.ValueName), manQuote(strings.Join(quoteV(opt.OptionalValue), ", ")))
+					optionalValue := strings.Join(quoteV(opt.OptionalValue), ", ")
+
+					fmt.Fprintf(wr, " [\\fI%s=%s\\fR]", manQuote(opt.ValueName), manQuote(optionalValue))
+					tagWidth += 4 + len(opt.ValueName) + len(optionalValue)
 				} else {
 					fmt.Fprintf(wr, " \\fI%s\\fR", manQuote(opt.ValueName))
+					tagWidth += 1 + len(opt.ValueName)
 				}
 			}
 
-			if len(opt.Default) != 0 {
-				fmt.Fprintf(wr, " <default: \\fI%s\\fR>", manQuote(strings.Join(quoteV(opt.Default), ", ")))
+			defaults := strings.Join(quoteV(opt.Default), ", ")
+			wrapDefaults := tagWidth+len(" <default: >")+len(defaults) > manTextWidth
+
+			if len(opt.Default) != 0 && !wrapDefaults {
+				fmt.Fprintf(wr, " <default: \\fI%s\\fR>", manQuote(defaults))
 			}
 
 			if opt.Required {
@@ -103,42 +199,63 @@ func writeManPageOptions(wr io.Writer, grp *Group) {
 
 			fmt.Fprintln(wr, "\\fP")
 
-			if len(opt.Description) != 0 {
-				formatForMan(wr, opt.Description, manQuoteLines)
+			if desc := opt.description(); len(desc) != 0 {
+				formatForMan(wr, wrapText(desc, manTextWidth, ""), manQuoteLines)
 				fmt.Fprintln(wr, "")
 			}
+
+			// Defaults which do not fit on the tag line are wrapped in
+			// the body of the option instead
+			if len(opt.Default) != 0 && wrapDefaults {
+				fmt.Fprintf(wr, "<default: \\fI%s\\fR>\n", manQuoteLines(wrapText(defaults, manTextWidth, "")))
+			}
 		}
-	})
+	}
 }
 
-func writeManPageSubcommands(wr io.Writer, name string, usagePrefix string, root *Command) {
-	commands := root.sortedVisibleCommands()
+func (p *Parser) writeManPageSubcommands(wr io.Writer, name string, usagePrefix string, root *Command) {
+	for _, category := range root.visibleCommandCategories() {
+		// Categories of top-level commands get their own section
+		if len(name) == 0 {
+			if category.Name == "" {
+				fmt.Fprintln(wr, ".SH COMMANDS")
+			} else {
+				fmt.Fprintf(wr, ".SH %s\n", manQuote(strings.ToUpper(category.Name)))
+			}
+		}
 
-	for _, c := range commands {
-		var nn string
+		for _, c := range category.Commands {
+			var nn string
 
-		if c.Hidden {
-			continue
-		}
+			if len(name) != 0 {
+				nn = name + " " + c.Name
+			} else {
+				nn = c.Name
+			}
 
-		if len(name) != 0 {
-			nn = name + " " + c.Name
-		} else {
-			nn = c.Name
-		}
+			// Commands added with AddCommandLazy which fail to load are
+			// left out
+			if err := p.loadCommand(c); err != nil {
+				p.printError(err)
+				continue
+			}
 
-		writeManPageCommand(wr, nn, usagePrefix, c)
+			p.writeManPageCommand(wr, nn, usagePrefix, c)
+		}
 	}
 }
 
-func writeManPageCommand(wr io.Writer, name string, usagePrefix string, command *Command) {
-	fmt.Fprintf(wr, ".SS %s\n", name)
-	fmt.Fprintln(wr, command.ShortDescription)
+func (p *Parser) writeManPageCommand(wr io.Writer, name string, usagePrefix string, command *Command) {
+	fmt.Fprintf(wr, ".SS %s\n", manQuote(name))
+	fmt.Fprintln(wr, manQuoteLines(command.ShortDescription))
 
-	if len(command.LongDescription) > 0 {
+	if hasManHeadings(command.LongDescription) {
+		fmt.Fprintln(wr, "")
+		writeManSections(wr, command.LongDescription)
+	} else if len(command.LongDescription) > 0 {
 		fmt.Fprintln(wr, "")
 
-		cmdstart := fmt.Sprintf("The %s command", manQuote(command.Name))
+		cmdstart := fmt.Sprintf("The %s command", command.Name)
 
 		if strings.HasPrefix(command.LongDescription, cmdstart) {
 			fmt.Fprintf(wr, "The \\fI%s\\fP command", manQuote(command.Name))
@@ -170,12 +287,23 @@ func writeManPageCommand(wr io.Writer, name string, usagePrefix string, command
 		fmt.Fprintf(wr, "\n\\fBAliases\\fP: %s\n\n", manQuote(strings.Join(command.Aliases, ", ")))
 	}
 
-	writeManPageOptions(wr, command.Group)
-	writeManPageSubcommands(wr, name, nextPrefix, command)
+	p.writeManPageOptions(wr, command.Group)
+
+	if len(command.Epilogue) > 0 {
+		fmt.Fprintln(wr, ".PP")
+		formatForMan(wr, command.Epilogue, manQuoteLines)
+		fmt.Fprintln(wr, "")
+	}
+
+	p.writeManPageSubcommands(wr, name, nextPrefix, command)
 }
 
 // WriteManPage writes a basic man page in groff format to the specified
-// writer.
+// writer. Lines of the form "## Heading" in the long description of a
+// command start a subsection of the command, and blank lines in such a
+// description separate paragraphs. Commands added with AddCommandLazy are
+// loaded (applying their Defaulters); a command which fails to load is left
+// out of the man page, and the error is printed if PrintErrors is set.
 func (p *Parser) WriteManPage(wr io.Writer) {
 	t := time.Now()
 	source_date_epoch := os.Getenv("SOURCE_DATE_EPOCH")
@@ -187,7 +315,13 @@ func (p *Parser) WriteManPage(wr io.Writer) {
 		t = time.Unix(sde, 0)
 	}
 
-	fmt.Fprintf(wr, ".TH %s 1 \"%s\"\n", manQuote(p.Name), t.Format("2 January 2006"))
+	section := p.ManSection
+
+	if section == 0 {
+		section = 1
+	}
+
+	fmt.Fprintf(wr, ".TH %s %d \"%s\"\n", manQuote(p.Name), section, t.Format("2 January 2006"))
 	fmt.Fprintln(wr, ".SH NAME")
 	fmt.Fprintf(wr, "%s \\- %s\n", manQuote(p.Name), manQuoteLines(p.ShortDescription))
 	fmt.Fprintln(wr, ".SH SYNOPSIS")
@@ -204,13 +338,38 @@ func (p *Parser) WriteManPage(wr io.Writer) {
 	formatForMan(wr, p.LongDescription, manQuoteLines)
 	fmt.Fprintln(wr, "")
 
+	if len(p.Epilogue) > 0 {
+		fmt.Fprintln(wr, ".PP")
+		formatForMan(wr, p.Epilogue, manQuoteLines)
+		fmt.Fprintln(wr, "")
+	}
+
 	fmt.Fprintln(wr, ".SH OPTIONS")
 
-	writeManPageOptions(wr, p.Command.Group)
+	p.writeManPageOptions(wr, p.Command.Group)
 
-	if len(p.visibleCommands()) > 0 {
-		fmt.Fprintln(wr, ".SH COMMANDS")
+	p.writeManPageSubcommands(wr, "", p.Name+" "+usage, p.Command)
 
-		writeManPageSubcommands(wr, "", p.Name+" "+usage, p.Command)
+	if len(p.ManAuthor) != 0 {
+		fmt.Fprintln(wr, ".SH AUTHOR")
+		formatForMan(wr, p.ManAuthor, manQuoteLines)
+		fmt.Fprintln(wr, "")
+	}
+
+	if len(p.ManSeeAlso) != 0 {
+		refs := make([]string, len(p.ManSeeAlso))
+
+		for i, ref := range p.ManSeeAlso {
+			refs[i] = manQuote(ref)
+		}
+
+		fmt.Fprintln(wr, ".SH SEE ALSO")
+		fmt.Fprintln(wr, strings.Join(refs, ",\n"))
+	}
+
+	if len(p.ManBugs) != 0 {
+		fmt.Fprintln(wr, ".SH BUGS")
+		formatForMan(wr, p.ManBugs, manQuoteLines)
+		fmt.Fprintln(wr, "")
 	}
 }
@@ -2,6 +2,7 @@ package flags
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -103,3 +104,44 @@ func TestMarshalError(t *testing.T) {
 
 	assertError(t, err, ErrMarshal, "Failed to marshal")
 }
+
+type flagValue struct {
+	values []string
+}
+
+func (f *flagValue) String() string {
+	return strings.Join(f.values, "+")
+}
+
+func (f *flagValue) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value")
+	}
+
+	f.values = append(f.values, value)
+	return nil
+}
+
+func TestFlagValue(t *testing.T) {
+	var opts = struct {
+		Value   flagValue    `long:"value"`
+		Pointer *flagValue   `long:"pointer"`
+		Slice   []*flagValue `long:"slice"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "--value", "a", "--value", "b", "--pointer", "c", "--slice", "d", "--slice", "e")
+
+	assertStringArray(t, ret, []string{})
+	assertStringArray(t, opts.Value.values, []string{"a", "b"})
+	assertStringArray(t, opts.Pointer.values, []string{"c"})
+
+	if len(opts.Slice) != 2 || opts.Slice[1].String() != "e" {
+		t.Errorf("Expected two slice elements, but got %v", opts.Slice)
+	}
+
+	expectConvert(t, p.FindOptionByLongName("value"), "a+b")
+	expectConvert(t, p.FindOptionByLongName("pointer"), "c")
+
+	_, err := p.ParseArgs([]string{"--value="})
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"value' (expected flags.flagValue): empty value")
+}
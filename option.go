@@ -3,11 +3,40 @@ package flags
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
 
+// OptionSource describes where the current value of an option came from.
+type OptionSource uint
+
+const (
+	// SourceDefault indicates that the option was not set while parsing and
+	// still holds the value it had before parsing.
+	SourceDefault OptionSource = iota
+
+	// SourceArg indicates that the option was set from a command line
+	// argument.
+	SourceArg
+)
+
+func (s OptionSource) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceArg:
+		return "argument"
+	}
+
+	return "unrecognized source"
+}
+
 // Option flag information. Contains a description of the option, short and
 // long name as well as a default value and whether an argument for this
 // flag is optional.
@@ -16,11 +45,20 @@ type Option struct {
 	// automatically in the built-in help.
 	Description string
 
+	// A short summary of the option, shown instead of the description in
+	// the help when the parser's CompactHelp is set.
+	Summary string
+
 	// The short name of the option (a single character). If not 0, the
 	// option flag can be 'activated' using -<ShortName>. Either ShortName
 	// or LongName needs to be non-empty.
 	ShortName rune
 
+	// Additional short names of the option. The option can also be
+	// activated using -<alias> for each of the aliases, but only ShortName
+	// is shown in the help.
+	ShortAliases []rune
+
 	// The long name of the option. If not "", the option flag can be
 	// activated using --<LongName>. Either ShortName or LongName needs
 	// to be non-empty.
@@ -47,7 +85,13 @@ type Option struct {
 	// error.
 	Required bool
 
-	// A name for the value of an option shown in the Help as --flag [ValueName]
+	// The environment variable key of the option, as given by the env tag.
+	// See EnvKeyWithNamespace for the key including the group env
+	// namespaces.
+	EnvDefaultKey string
+
+	// A name for the value of an option shown in the Help as --flag [ValueName].
+	// The value name is also reported for option completions.
 	ValueName string
 
 	// A mask value to show in the help instead of the default value. This
@@ -61,6 +105,15 @@ type Option struct {
 	// If true, the option is not displayed in the help or man page
 	Hidden bool
 
+	// If true, the option is experimental and can only be used when the
+	// parser allows experimental options (see Parser.AllowExperimental)
+	Experimental bool
+
+	// If non empty, the option is only available on these operating systems
+	// (as reported by runtime.GOOS). On other systems the option is hidden
+	// and treated as unknown
+	OS []string
+
 	// The group which the option belongs to
 	group *Group
 
@@ -76,9 +129,22 @@ type Option struct {
 	tag                     multiTag
 	isSet                   bool
 	isSetDefault            bool
+	source                  OptionSource
 	preventDefault          bool
 	clearReferenceBeforeSet bool
 
+	// Whether the value was set by a Defaulter, in which case it takes
+	// precedence over the default tag
+	codeDefault bool
+
+	// The files opened for a file option, see the open-mode tag
+	opened []*os.File
+
+	// The minimum and maximum number of values of a slice option, as given
+	// by the min and max tags, or 0 if there is no limit
+	minCount int
+	maxCount int
+
 	defaultLiteral string
 }
 
@@ -87,18 +153,49 @@ type Option struct {
 // itself are separated by the parser's namespace delimiter. If the long name is
 // empty an empty string is returned.
 func (option *Option) LongNameWithNamespace() string {
-	if len(option.LongName) == 0 {
+	return option.withNamespace(option.LongName,
+		func(p *Parser) string { return p.NamespaceDelimiter },
+		func(g *Group) string { return g.Namespace })
+}
+
+// EnvKeyWithNamespace returns the option's env key with the group env
+// namespaces prepended by walking up the option's group tree. Env namespaces
+// and the env key itself are separated by the parser's env namespace
+// delimiter, independently of the namespace delimiter used for long names. If
+// the env key is empty an empty string is returned.
+func (option *Option) EnvKeyWithNamespace() string {
+	return option.withNamespace(option.EnvDefaultKey,
+		func(p *Parser) string { return p.EnvNamespaceDelimiter },
+		func(g *Group) string { return g.EnvNamespace })
+}
+
+// EnvKeys returns the environment variable names bound to the option,
+// including the group env namespaces (see EnvKeyWithNamespace). If the option
+// has no env key, an empty slice is returned.
+func (option *Option) EnvKeys() []string {
+	key := option.EnvKeyWithNamespace()
+
+	if key == "" {
+		return []string{}
+	}
+
+	return []string{key}
+}
+
+// withNamespace prepends the namespaces of the groups of the option, as given
+// by namespace, to name. The delimiter is fetched from the parser, which is
+// always at the end of the group hierarchy.
+func (option *Option) withNamespace(name string, delimiter func(*Parser) string, namespace func(*Group) string) string {
+	if len(name) == 0 {
 		return ""
 	}
 
-	// fetch the namespace delimiter from the parser which is always at the
-	// end of the group hierarchy
 	namespaceDelimiter := ""
 	g := option.group
 
 	for {
 		if p, ok := g.parent.(*Parser); ok {
-			namespaceDelimiter = p.NamespaceDelimiter
+			namespaceDelimiter = delimiter(p)
 
 			break
 		}
@@ -111,13 +208,12 @@ func (option *Option) LongNameWithNamespace() string {
 		}
 	}
 
-	// concatenate long name with namespace
-	longName := option.LongName
+	// concatenate name with namespace
 	g = option.group
 
 	for g != nil {
-		if g.Namespace != "" {
-			longName = g.Namespace + namespaceDelimiter + longName
+		if ns := namespace(g); ns != "" {
+			name = ns + namespaceDelimiter + name
 		}
 
 		switch i := g.parent.(type) {
@@ -130,7 +226,7 @@ func (option *Option) LongNameWithNamespace() string {
 		}
 	}
 
-	return longName
+	return name
 }
 
 // String converts an option to a human friendly readable string describing the
@@ -168,45 +264,103 @@ func (option *Option) Field() reflect.StructField {
 	return option.field
 }
 
-// IsSet returns true if option has been set
+// Group returns the group the option belongs to.
+func (option *Option) Group() *Group {
+	return option.group
+}
+
+// Command returns the command the option belongs to. For options of the
+// top-level parser, this is the parser's command.
+func (option *Option) Command() *Command {
+	g := option.group
+
+	for g != nil {
+		switch i := g.parent.(type) {
+		case *Group:
+			g = i
+		case *Command:
+			return i.commandOfGroup(g)
+		case *Parser:
+			return i.Command.commandOfGroup(g)
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// IsSet returns true if option has been set by the last parse, i.e. it was
+// specified on the command line. Values assigned before parsing or by a
+// Defaulter do not count as set.
 func (option *Option) IsSet() bool {
 	return option.isSet
 }
 
-// IsSetDefault returns true if option has been set via the default option tag
+// Source returns where the value of the option was last set from during
+// parsing.
+func (option *Option) Source() OptionSource {
+	return option.source
+}
+
+// IsSetDefault returns true if the value of the option was changed by a
+// Defaulter at the start of the last parse and was not replaced by the
+// command line. Since the default tag only describes the default in the
+// help, values which merely match it are not reported.
 func (option *Option) IsSetDefault() bool {
 	return option.isSetDefault
 }
 
+// DefaultStrings returns the values of the default tags of the option as
+// declared, before conversion to the type of the option. It returns nil if
+// the option has no default.
+func (option *Option) DefaultStrings() []string {
+	if option.Default == nil {
+		return nil
+	}
+
+	return append([]string{}, option.Default...)
+}
+
+// HasDefault returns true if the option declares a default value. Unlike
+// checking the value of the option for its zero value, this distinguishes
+// an empty default (default:"") from no default at all.
+func (option *Option) HasDefault() bool {
+	return len(option.Default) != 0
+}
+
+// SetChoices sets the values allowed for the option, replacing any values
+// given by the choice tag. An empty list allows any value. The choices are
+// used for validation and in the help, and take effect from the next parse on.
+// The current choices are available in the Choices field.
+func (option *Option) SetChoices(choices []string) {
+	option.Choices = append([]string(nil), choices...)
+}
+
 // Set the value of an option to the specified value. An error will be returned
 // if the specified value could not be converted to the corresponding option
 // value type.
 func (option *Option) Set(value *string) error {
 	kind := option.value.Type().Kind()
 
-	if (kind == reflect.Map || kind == reflect.Slice) && option.clearReferenceBeforeSet {
+	if (kind == reflect.Map || kind == reflect.Slice || option.isCounter()) && option.clearReferenceBeforeSet {
 		option.empty()
 	}
 
 	option.isSet = true
+	option.isSetDefault = false
 	option.preventDefault = true
 	option.clearReferenceBeforeSet = false
 
 	if len(option.Choices) != 0 {
-		found := false
-
-		for _, choice := range option.Choices {
-			if choice == *value {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			allowed := strings.Join(option.Choices[0:len(option.Choices)-1], ", ")
-
-			if len(option.Choices) > 1 {
-				allowed += " or " + option.Choices[len(option.Choices)-1]
+		if !option.isValidChoice(*value) {
+			choices := option.displayChoices()
+			allowed := strings.Join(choices[0:len(choices)-1], ", ")
+
+			if len(choices) > 1 {
+				allowed += " or " + choices[len(choices)-1]
+			} else {
+				allowed = choices[0]
 			}
 
 			return newErrorf(ErrInvalidChoice,
@@ -217,15 +371,110 @@ func (option *Option) Set(value *string) error {
 
 	if option.isFunc() {
 		return option.call(value)
+	} else if option.isCounter() {
+		return option.increment()
+	} else if option.isSetter() && value != nil {
+		return option.setPath(*value)
+	} else if option.isFile() && value != nil {
+		return option.openFile(*value)
 	} else if value != nil {
-		return convert(*value, option.value, option.tag)
+		v := *value
+
+		if option.isAbsPath() && v != "" {
+			abs, err := filepath.Abs(v)
+
+			if err != nil {
+				return err
+			}
+
+			v = abs
+		}
+
+		return convert(v, option.value, option.tag)
 	}
 
 	return convert("", option.value, option.tag)
 }
 
+// completionValueName returns the value name to report for the option during
+// completion, or an empty string if the option does not take an argument.
+func (option *Option) completionValueName() string {
+	if !option.canArgument() {
+		return ""
+	}
+
+	return option.ValueName
+}
+
+// description returns the description of the option, as provided by the
+// DescriptionProvider of the group of the option if any.
+func (option *Option) description() string {
+	if option.group != nil {
+		if provider, ok := option.group.data.(DescriptionProvider); ok {
+			if desc, ok := provider.OptionDescription(option.LongName); ok {
+				return desc
+			}
+		}
+	}
+
+	return option.Description
+}
+
 func (option *Option) showInHelp() bool {
-	return !option.Hidden && (option.ShortName != 0 || len(option.LongName) != 0)
+	return !option.isHidden() && (option.ShortName != 0 || len(option.LongName) != 0)
+}
+
+// isHidden returns whether the option is hidden, either explicitly, because
+// it is experimental and experimental options are not allowed, or because it
+// is not available on the current operating system.
+func (option *Option) isHidden() bool {
+	return option.Hidden || (option.Experimental && !option.experimentalAllowed()) || !option.isAvailable()
+}
+
+// goos is the operating system against which the os tag is evaluated.
+var goos = runtime.GOOS
+
+// isAvailable returns whether the option is available on the current
+// operating system.
+func (option *Option) isAvailable() bool {
+	if len(option.OS) == 0 {
+		return true
+	}
+
+	for _, system := range option.OS {
+		if system == goos {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (option *Option) experimentalAllowed() bool {
+	p := option.parser()
+
+	return p != nil && p.AllowExperimental
+}
+
+// parser returns the parser the option belongs to, or nil if the option is
+// not part of a parser.
+func (option *Option) parser() *Parser {
+	g := option.group
+
+	for g != nil {
+		switch i := g.parent.(type) {
+		case *Parser:
+			return i
+		case *Command:
+			g = i.Group
+		case *Group:
+			g = i
+		default:
+			g = nil
+		}
+	}
+
+	return nil
 }
 
 func (option *Option) canArgument() bool {
@@ -233,6 +482,10 @@ func (option *Option) canArgument() bool {
 		return true
 	}
 
+	if option.isCounter() {
+		return false
+	}
+
 	return !option.isBool()
 }
 
@@ -317,6 +570,24 @@ func (option *Option) isBool() bool {
 	}
 }
 
+func (option *Option) isScalarBool() bool {
+	tp := option.value.Type()
+
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	return tp.Kind() == reflect.Bool
+}
+
+func (option *Option) isGreedy() bool {
+	return option.value.Type().Kind() == reflect.Slice && !isStringFalsy(option.tag.Get("greedy"))
+}
+
+func (option *Option) allowsDashValue() bool {
+	return !isStringFalsy(option.tag.Get("allow-dash-value"))
+}
+
 func (option *Option) isSignedNumber() bool {
 	tp := option.value.Type()
 
@@ -336,10 +607,351 @@ func (option *Option) isFunc() bool {
 	return option.value.Type().Kind() == reflect.Func
 }
 
+func (option *Option) isCounter() bool {
+	if isStringFalsy(option.tag.Get("counter")) {
+		return false
+	}
+
+	return isIntKind(option.value.Type().Kind())
+}
+
+// shortNames returns the short name of the option followed by its short
+// aliases, or nil if the option has no short name.
+func (option *Option) shortNames() []rune {
+	if option.ShortName == 0 {
+		return nil
+	}
+
+	return append([]rune{option.ShortName}, option.ShortAliases...)
+}
+
+// hasShortName returns whether the option can be activated using the given
+// short name, which is either its short name or one of its short aliases.
+func (option *Option) hasShortName(name rune) bool {
+	for _, r := range option.shortNames() {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// choiceRange parses a choice of the form min..max of an integer option,
+// returning the inclusive bounds of the range. The bounds are parsed like
+// the values of the option (see the base tag).
+func (option *Option) choiceRange(choice string) (int64, int64, bool) {
+	tp := option.value.Type()
+
+	if tp.Kind() == reflect.Slice || tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if !isIntKind(tp.Kind()) {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(choice, "..", 2)
+
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	min, err := parseInt(parts[0], option.tag, 64)
+
+	if err != nil {
+		return 0, 0, false
+	}
+
+	max, err := parseInt(parts[1], option.tag, 64)
+
+	if err != nil || max < min {
+		return 0, 0, false
+	}
+
+	return min, max, true
+}
+
+func (option *Option) isValidChoice(value string) bool {
+	for _, choice := range option.Choices {
+		if choice == value {
+			return true
+		}
+
+		if min, max, ok := option.choiceRange(choice); ok {
+			if v, err := parseInt(value, option.tag, 64); err == nil && v >= min && v <= max {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// displayChoices returns the choices of the option as shown to the user, with
+// ranges written as min-max (in the base of the option).
+func (option *Option) displayChoices() []string {
+	ret := make([]string, len(option.Choices))
+	base, _ := getBase(option.tag, 10)
+
+	for i, choice := range option.Choices {
+		if min, max, ok := option.choiceRange(choice); ok {
+			ret[i] = strconv.FormatInt(min, base) + "-" + strconv.FormatInt(max, base)
+		} else {
+			ret[i] = choice
+		}
+	}
+
+	return ret
+}
+
+func (option *Option) isAbsPath() bool {
+	return !isStringFalsy(option.tag.Get("abs-path")) && isStringOrStringSlice(option.value.Type())
+}
+
+// parseCountLimits parses the min and max tags of a slice option.
+func (option *Option) parseCountLimits() error {
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{
+		{"min", &option.minCount},
+		{"max", &option.maxCount},
+	} {
+		s := option.tag.Get(limit.name)
+
+		if s == "" {
+			continue
+		}
+
+		if option.value.Type().Kind() != reflect.Slice {
+			return newErrorf(ErrInvalidTag,
+				"%s flag `%s' must be a slice",
+				limit.name, option.shortAndLongName())
+		}
+
+		n, err := strconv.Atoi(s)
+
+		if err != nil || n < 0 {
+			return newErrorf(ErrInvalidTag,
+				"invalid %s `%s' for flag `%s'",
+				limit.name, s, option.shortAndLongName())
+		}
+
+		*limit.value = n
+	}
+
+	if option.maxCount != 0 && option.maxCount < option.minCount {
+		return newErrorf(ErrInvalidTag,
+			"max of flag `%s' must not be less than its min",
+			option.shortAndLongName())
+	}
+
+	return nil
+}
+
+// checkCount checks the number of values given for a slice option in the
+// last parse against its min and max tags. Values which were not given on
+// the command line (such as defaults) are not counted.
+func (option *Option) checkCount() error {
+	if option.minCount == 0 && option.maxCount == 0 {
+		return nil
+	}
+
+	n := 0
+
+	if option.source == SourceArg {
+		n = option.value.Len()
+	}
+
+	if n < option.minCount {
+		return newErrorf(ErrRequired,
+			"the flag `%s' must be specified at least %d times",
+			option, option.minCount)
+	}
+
+	if option.maxCount != 0 && n > option.maxCount {
+		return newErrorf(ErrTooMany,
+			"the flag `%s' can be specified at most %d times",
+			option, option.maxCount)
+	}
+
+	return nil
+}
+
+func (option *Option) isClearable() bool {
+	if isStringFalsy(option.tag.Get("clearable")) {
+		return false
+	}
+
+	kind := option.value.Type().Kind()
+	return kind == reflect.Slice || kind == reflect.Map
+}
+
+func (option *Option) hasAppendOperator() bool {
+	return !isStringFalsy(option.tag.Get("append-operator"))
+}
+
+// clear sets a clearable option to an empty, but non-nil, slice or map.
+func (option *Option) clear() {
+	tp := option.value.Type()
+
+	if tp.Kind() == reflect.Map {
+		option.value.Set(reflect.MakeMap(tp))
+	} else {
+		option.value.Set(reflect.MakeSlice(tp, 0, 0))
+	}
+
+	option.isSet = true
+	option.isSetDefault = false
+	option.preventDefault = true
+	option.clearReferenceBeforeSet = false
+}
+
+var (
+	fileType   = reflect.TypeOf((*os.File)(nil))
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	writerType = reflect.TypeOf((*io.Writer)(nil)).Elem()
+)
+
+func isFileType(tp reflect.Type) bool {
+	return tp == fileType || tp == readerType || tp == writerType
+}
+
+func (option *Option) isFile() bool {
+	return isFileType(option.value.Type())
+}
+
+// fileOpenFlags returns the flags used to open the file of a file option with
+// the given type for the given open mode, and whether the file is written to.
+func fileOpenFlags(tp reflect.Type, mode string) (int, bool, bool) {
+	if mode == "" {
+		if tp == writerType {
+			mode = "write"
+		} else {
+			mode = "read"
+		}
+	}
+
+	switch mode {
+	case "read":
+		return os.O_RDONLY, false, true
+	case "write":
+		return os.O_WRONLY | os.O_CREATE | os.O_TRUNC, true, true
+	case "append":
+		return os.O_WRONLY | os.O_CREATE | os.O_APPEND, true, true
+	case "readwrite":
+		return os.O_RDWR | os.O_CREATE, true, true
+	}
+
+	return 0, false, false
+}
+
+// openFile opens the file at path for a file option and assigns it to the
+// option value. The special path "-" refers to stdin for options which are
+// only read from, and to stdout otherwise.
+func (option *Option) openFile(path string) error {
+	flag, write, _ := fileOpenFlags(option.value.Type(), option.tag.Get("open-mode"))
+
+	if p := option.parser(); p != nil && p.validating {
+		return nil
+	}
+
+	var file *os.File
+
+	if path == "-" {
+		if write {
+			file = os.Stdout
+		} else {
+			file = os.Stdin
+		}
+	} else {
+		f, err := os.OpenFile(path, flag, 0666)
+
+		if err != nil {
+			return err
+		}
+
+		option.opened = append(option.opened, f)
+		file = f
+	}
+
+	option.value.Set(reflect.ValueOf(file))
+	return nil
+}
+
+func (option *Option) increment() error {
+	switch option.value.Type().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		option.value.SetInt(option.value.Int() + 1)
+	default:
+		option.value.SetUint(option.value.Uint() + 1)
+	}
+
+	return nil
+}
+
+func (option *Option) isSetter() bool {
+	return !isStringFalsy(option.tag.Get("setter"))
+}
+
+// setPath applies a path=value argument to the struct of a setter option. The
+// path is a dot separated list of (case insensitive) field names.
+func (option *Option) setPath(value string) error {
+	idx := strings.IndexRune(value, '=')
+
+	if idx < 0 {
+		return fmt.Errorf("expected path=value, but got `%s'", value)
+	}
+
+	path := value[:idx]
+	target := option.value
+
+	var tag multiTag
+
+	for _, name := range strings.Split(path, ".") {
+		for target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				target.Set(reflect.New(target.Type().Elem()))
+			}
+
+			target = target.Elem()
+		}
+
+		found := false
+
+		if target.Kind() == reflect.Struct {
+			tp := target.Type()
+
+			for i := 0; i < tp.NumField(); i++ {
+				field := tp.Field(i)
+
+				if field.PkgPath == "" && strings.EqualFold(field.Name, name) {
+					target = target.Field(i)
+					tag = newMultiTag(string(field.Tag))
+					found = true
+
+					break
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown path `%s'", path)
+		}
+	}
+
+	return convert(value[idx+1:], target, tag)
+}
+
 func (option *Option) call(value *string) error {
 	var retval []reflect.Value
 
 	if value == nil {
+		if p := option.parser(); p != nil && p.validating {
+			return nil
+		}
+
 		retval = option.value.Call(nil)
 	} else {
 		tp := option.value.Type().In(0)
@@ -351,6 +963,10 @@ func (option *Option) call(value *string) error {
 			return err
 		}
 
+		if p := option.parser(); p != nil && p.validating {
+			return nil
+		}
+
 		retval = option.value.Call([]reflect.Value{val})
 	}
 
@@ -369,7 +985,7 @@ func (option *Option) updateDefaultLiteral() {
 	defs := option.Default
 	def := ""
 
-	if len(defs) == 0 && option.canArgument() {
+	if (len(defs) == 0 || option.codeDefault) && option.canArgument() {
 		var showdef bool
 
 		switch option.field.Type.Kind() {
@@ -384,17 +1000,28 @@ func (option *Option) updateDefaultLiteral() {
 			showdef = !reflect.DeepEqual(zeroval.Interface(), option.value.Interface())
 		}
 
+		showdef = showdef || option.codeDefault
+
 		if showdef {
 			def, _ = convertToString(option.value, option.tag)
 		}
 	} else if len(defs) != 0 {
+		// An empty default is still a default, so it is shown quoted
+		quote := func(s string) string {
+			if s == "" {
+				return strconv.Quote(s)
+			}
+
+			return quoteIfNeeded(s)
+		}
+
 		l := len(defs) - 1
 
 		for i := 0; i < l; i++ {
-			def += quoteIfNeeded(defs[i]) + ", "
+			def += quote(defs[i]) + ", "
 		}
 
-		def += quoteIfNeeded(defs[l])
+		def += quote(defs[l])
 	}
 
 	option.defaultLiteral = def
@@ -423,7 +1050,7 @@ func (option *Option) isValidValue(arg string) error {
 	if validator := option.isValueValidator(); validator != nil {
 		return validator.IsValidValue(arg)
 	}
-	if argumentIsOption(arg) && !(option.isSignedNumber() && len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9') {
+	if argumentIsOption(arg) && !option.allowsDashValue() && !(option.isSignedNumber() && len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9') {
 		return fmt.Errorf("expected argument for flag `%s', but got option `%s'", option, arg)
 	}
 	return nil
@@ -70,6 +70,31 @@ func TestPassAfterNonOptionWithPositional(t *testing.T) {
 	assertStringArray(t, opts.Positional.Rest, []string{"arg", "-v", "-g"})
 }
 
+func TestStopAtFirstPositional(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+
+		Positional struct {
+			Rest []string
+		} `positional-args:"yes"`
+	}{}
+
+	p := NewParser(&opts, StopAtFirstPositional)
+	ret, err := p.ParseArgs([]string{"-v", "arg", "-v", "--", "-g"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+		return
+	}
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+
+	assertStringArray(t, ret, []string{"arg", "-v", "--", "-g"})
+	assertStringArray(t, opts.Positional.Rest, []string{})
+}
+
 func TestPassAfterNonOptionWithPositionalIntPass(t *testing.T) {
 	var opts = struct {
 		Value bool `short:"v"`
@@ -141,3 +166,134 @@ func TestPassAfterNonOptionWithPositionalIntFail(t *testing.T) {
 		assertStringArray(t, ret, test.ret)
 	}
 }
+
+func TestTerminated(t *testing.T) {
+	var tests = []struct {
+		options Options
+		args    []string
+		index   int
+		ret     []string
+	}{
+		{PassDoubleDash, []string{"-v", "foo"}, -1, []string{"foo"}},
+		{PassDoubleDash, []string{"-v", "--", "foo"}, 1, []string{"foo"}},
+		{None, []string{"foo", "--", "bar", "--"}, 1, []string{"foo", "--", "bar", "--"}},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			Value bool `short:"v"`
+		}{}
+
+		p := NewParser(&opts, test.options)
+		ret, err := p.ParseArgs(test.args)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if p.Terminated() != (test.index >= 0) {
+			t.Errorf("Expected Terminated() to be %v for %v", test.index >= 0, test.args)
+		}
+
+		if p.TerminatorIndex() != test.index {
+			t.Errorf("Expected terminator index %d for %v, but got %d", test.index, test.args, p.TerminatorIndex())
+		}
+
+		assertStringArray(t, ret, test.ret)
+	}
+}
+
+func TestArgsTerminator(t *testing.T) {
+	var tests = []struct {
+		disableDoubleDash bool
+		args              []string
+		index             int
+		ret               []string
+	}{
+		{false, []string{"-v", "::", "-v", "foo"}, 1, []string{"-v", "foo"}},
+		{false, []string{"-v", "--", "::", "foo"}, 1, []string{"::", "foo"}},
+		{true, []string{"--", "::", "-v"}, 1, []string{"--", "-v"}},
+		{true, []string{"foo", "--"}, -1, []string{"foo", "--"}},
+	}
+
+	for _, test := range tests {
+		var opts = struct {
+			Value bool `short:"v"`
+		}{}
+
+		p := NewParser(&opts, PassDoubleDash)
+		p.ArgsTerminator = "::"
+		p.DisableDoubleDash = test.disableDoubleDash
+
+		ret, err := p.ParseArgs(test.args)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if p.TerminatorIndex() != test.index {
+			t.Errorf("Expected terminator index %d for %v, but got %d", test.index, test.args, p.TerminatorIndex())
+		}
+
+		assertStringArray(t, ret, test.ret)
+	}
+}
+
+func TestArgsTerminatorPassthrough(t *testing.T) {
+	var opts = struct {
+		Value bool     `short:"v"`
+		Expr  []string `passthrough:"yes"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.ArgsTerminator = "::"
+
+	ret, err := p.ParseArgs([]string{"-v", "::", "a", "-v", "::"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertStringArray(t, opts.Expr, []string{"a", "-v", "::"})
+}
+
+func TestTerminatorIndexPreParse(t *testing.T) {
+	var opts = struct {
+		Command struct {
+			Verbose []bool `short:"v"`
+		} `command:"cmd"`
+	}{}
+
+	p := NewParser(&opts, PassDoubleDash)
+
+	p.Find("cmd").PreParse = func(args []string) ([]string, error) {
+		if len(args) != 0 && args[0] == "vvv" {
+			return append([]string{"-v", "-v", "-v"}, args[1:]...), nil
+		}
+
+		return args, nil
+	}
+
+	ret, err := p.ParseArgs([]string{"cmd", "vvv", "--", "foo"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"foo"})
+
+	if p.TerminatorIndex() != 4 {
+		t.Errorf("Expected terminator index 4, but got %d", p.TerminatorIndex())
+	}
+
+	consumed, _ := p.LastArgs()
+
+	if consumed[p.TerminatorIndex()] != "--" {
+		t.Errorf("Expected the terminator at index %d of %v", p.TerminatorIndex(), consumed)
+	}
+}
@@ -7,6 +7,7 @@ package flags
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"reflect"
@@ -32,6 +33,103 @@ type Parser struct {
 	// EnvNamespaceDelimiter separates group env namespaces and env keys
 	EnvNamespaceDelimiter string
 
+	// MaskDefaults replaces the default value of every option shown in the
+	// help with ***. Options with an explicit default-mask keep showing
+	// their own mask, and a default-mask of "-" still hides the default.
+	MaskDefaults bool
+
+	// SortOptions sorts the options of each group in the help and man page
+	// by long name, followed by options with only a short name sorted by
+	// short name. By default options are shown in declaration order.
+	SortOptions bool
+
+	// ManSection is the manual section written in the generated man page.
+	// If zero, section 1 (user commands) is used.
+	ManSection int
+
+	// ManAuthor is written as the AUTHOR section of the generated man page
+	// when non-empty.
+	ManAuthor string
+
+	// ManSeeAlso lists references (e.g. "git(1)") written as the SEE ALSO
+	// section of the generated man page when non-empty.
+	ManSeeAlso []string
+
+	// ManBugs is written as the BUGS section of the generated man page when
+	// non-empty.
+	ManBugs string
+
+	// ShowHelpGroup shows the built-in Help Options group (see the HelpFlag
+	// option) in the help message. It is true for parsers created with
+	// NewParser or NewNamedParser. When false, the group is omitted from the
+	// help message, but the help options keep working.
+	ShowHelpGroup bool
+
+	// CompactHelp shows the summary of options which have one (see the
+	// summary tag) instead of their description in the help. The man page
+	// always shows the full description.
+	CompactHelp bool
+
+	// Version is the version reported by the built-in --version option (see
+	// the VersionFlag option).
+	Version string
+
+	// AtomicParse restores the values of all option, positional argument and
+	// passthrough fields, as well as the state of the options (e.g. IsSet
+	// and Source) and the active commands, when ParseArgs returns an error
+	// other than ErrHelp or ErrVersion, so that the option structs are left
+	// untouched by a failed parse. The values are deep copied before every
+	// parse, which costs time and memory proportional to the size of the
+	// values. Function options which have already been called are not
+	// undone.
+	AtomicParse bool
+
+	// ErrorFormatter, if set, renders the message of every *Error returned
+	// (and printed) by the parser, e.g. to translate messages. It receives
+	// the error with its original English message and returns the new
+	// message. The type of the error is left unchanged. Note that the
+	// message of an ErrHelp error is the help message itself.
+	ErrorFormatter func(err *Error) string
+
+	// ErrorWriter is the writer to which errors are printed when the
+	// PrintErrors option is set. If nil, errors are printed to os.Stderr.
+	// The help message shown for ErrHelp is still printed to os.Stdout.
+	ErrorWriter io.Writer
+
+	// ArgsTerminator is the argument which separates options from the
+	// remaining arguments, e.g. "::". It is handled like the double dash:
+	// the arguments after it are assigned to the passthrough field, or
+	// passed as arguments with the PassDoubleDash option. If empty, the
+	// double dash (--) is the terminator.
+	ArgsTerminator string
+
+	// DisableDoubleDash stops the double dash (--) from terminating the
+	// options when a custom ArgsTerminator is set. By default both are
+	// recognized.
+	DisableDoubleDash bool
+
+	// Trace, if set, is called to log the decisions made while parsing: each
+	// argument seen, the options and commands it selected and the values
+	// assigned, as well as the defaults applied by Defaulters. The messages
+	// have the following stable formats, so that they can be asserted in
+	// tests:
+	//
+	//     applying defaults of %T
+	//     argument `%s'
+	//     flag `%s' set to `%s'
+	//     positional argument `%s' assigned to `%s'
+	//     command `%s' activated
+	//     unknown flag `%s' not treated as an error
+	//     error: %s
+	//
+	// Nothing is formatted or allocated for tracing when Trace is nil.
+	Trace func(format string, args ...interface{})
+
+	// AllowExperimental allows the use of options marked as experimental.
+	// When false, experimental options are hidden from the help, man page
+	// and completion, and using them results in an ErrExperimental error.
+	AllowExperimental bool
+
 	// UnknownOptionsHandler is a function which gets called when the parser
 	// encounters an unknown option. The function receives the unknown option
 	// name, a SplitArgument which specifies its value if set with an argument
@@ -58,6 +156,10 @@ type Parser struct {
 	internalError error
 
 	state *parseState
+
+	// Whether the parser is validating arguments (see Validate), in which
+	// case function options are not called and files are not opened
+	validating bool
 }
 
 // SplitArgument represents the argument value of an option that was passed using
@@ -105,8 +207,8 @@ const (
 	IgnoreUnknown
 
 	// PrintErrors prints any errors which occurred during parsing to
-	// os.Stderr. In the special case of ErrHelp, the message will be printed
-	// to os.Stdout.
+	// os.Stderr, or to the parser's ErrorWriter if set. In the special case
+	// of ErrHelp, the message will be printed to os.Stdout.
 	PrintErrors
 
 	// PassAfterNonOption passes all arguments after the first non option
@@ -114,6 +216,46 @@ const (
 	// POSIX processing.
 	PassAfterNonOption
 
+	// AllowBoolValues allows a user to assign an explicit value to a
+	// non-slice boolean option, either as --flag=value or as --flag value.
+	// Accepted values are those of strconv.ParseBool as well as yes and no.
+	// In the space separated form the next argument is only consumed if it
+	// is such a boolean value. Invalid values result in an ErrMarshal error.
+	AllowBoolValues
+
+	// PassUnknownAsArgs passes any unknown options, in their original form,
+	// as remaining command line arguments instead of generating an error.
+	// Unlike IgnoreUnknown, it also tries to pass along the value of an
+	// unknown option. A value attached to the option (--foo=bar, -fbar) is
+	// passed as part of the same argument. For an unknown long option
+	// without an attached value, the next argument is assumed to be its
+	// value and is passed as well, unless that argument looks like an
+	// option or is a double dash. Unknown short options never consume the
+	// next argument, since they cannot be told apart from boolean flags.
+	PassUnknownAsArgs
+
+	// StopAtFirstPositional stops parsing at the first non option argument
+	// which is not a command. That argument and all remaining arguments are
+	// returned verbatim as remaining command line arguments. Unlike
+	// PassAfterNonOption, the arguments are not assigned to positional
+	// arguments.
+	StopAtFirstPositional
+
+	// VersionFlag adds a Version Options group to the parser containing a
+	// --version option. When --version is specified on the command line,
+	// parsing stops and the parser returns the special error of type
+	// ErrVersion, with the parser's Version as its message. When
+	// PrintErrors is also specified, the version is printed to os.Stdout.
+	// The option is not added if the parser already has a --version option.
+	VersionFlag
+
+	// AllowPrefixMatch allows long options to be abbreviated to any prefix
+	// of their long name (e.g. --verb for --verbose), as long as the prefix
+	// is unambiguous. A prefix matching more than one option results in an
+	// ErrAmbiguousFlag error. An exact match always takes precedence over a
+	// prefix match, and hidden options can only be matched exactly.
+	AllowPrefixMatch
+
 	// Default is a convenient default set of options which should cover
 	// most of the uses of the flags package.
 	Default = HelpFlag | PrintErrors | PassDoubleDash
@@ -122,10 +264,14 @@ const (
 type parseState struct {
 	arg        string
 	args       []string
+	allArgs    []string
 	retargs    []string
 	positional []*Arg
 	err        error
 
+	// The index of the double dash in the parsed arguments, or -1
+	terminator int
+
 	command *Command
 	lookup  lookup
 }
@@ -179,6 +325,7 @@ func NewNamedParser(appname string, options Options) *Parser {
 		Options:               options,
 		NamespaceDelimiter:    ".",
 		EnvNamespaceDelimiter: "_",
+		ShowHelpGroup:         true,
 	}
 
 	p.Command.parent = p
@@ -192,6 +339,24 @@ func (p *Parser) Parse() ([]string, error) {
 	return p.ParseArgs(os.Args[1:])
 }
 
+// ParseCommandLine parses the command line arguments of the program, i.e.
+// os.Args without the program name. It is equivalent to Parse.
+func (p *Parser) ParseCommandLine() ([]string, error) {
+	return p.ParseArgs(os.Args[1:])
+}
+
+// ParseArgs0 parses a list of arguments which, like os.Args, starts with the
+// program name. The first element is skipped and the remaining arguments are
+// parsed using ParseArgs. Note that ParseArgs itself expects the arguments
+// without the program name.
+func (p *Parser) ParseArgs0(args []string) ([]string, error) {
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	return p.ParseArgs(args)
+}
+
 func (p *Parser) ParseFlags() error {
 	return p.ParseFlagsArgs(os.Args[1:])
 }
@@ -217,26 +382,110 @@ func (p *Parser) handleCompletion(args []string) bool {
 	return false
 }
 
-func (p *Parser) ParseFlagsArgs(args []string) error {
-	if p.internalError != nil {
-		return p.internalError
+// prepareCommand readies the options of the command and its subcommands for
+// parsing.
+func (p *Parser) prepareCommand(c *Command) {
+	var defaulters []Defaulter
+
+	c.eachCommand(func(cc *Command) {
+		cc.eachGroup(func(g *Group) {
+			if d, ok := g.data.(Defaulter); ok {
+				defaulters = append(defaulters, d)
+			}
+		})
+	}, true)
+
+	// Remember the option values to find the ones changed by defaulters. The
+	// values are deep copied to also find slices and maps changed in place
+	values := make(map[*Option]reflect.Value)
+
+	c.eachOption(func(c *Command, g *Group, option *Option) {
+		if len(defaulters) != 0 && !p.validating && !option.isFunc() {
+			values[option] = deepCopy(option.value)
+		}
+	})
+
+	// Defaulters are not called while validating, the code defaults found
+	// by the last parse are kept instead
+	if p.validating {
+		defaulters = nil
 	}
 
-	p.eachOption(func(c *Command, g *Group, option *Option) {
+	for _, d := range defaulters {
+		if p.Trace != nil {
+			p.Trace("applying defaults of %T", d)
+		}
+		d.SetDefaults()
+	}
+
+	c.eachOption(func(c *Command, g *Group, option *Option) {
+		if !p.validating {
+			value, ok := values[option]
+			option.codeDefault = ok && !reflect.DeepEqual(value.Interface(), option.value.Interface())
+		}
+
+		option.isSet = false
+		option.isSetDefault = option.codeDefault
 		option.clearReferenceBeforeSet = true
+		option.source = SourceDefault
+		option.opened = nil
 		option.updateDefaultLiteral()
 	})
 
+	// Add built-in version group to the top-level command if necessary
+	if c == p.Command && (p.Options&VersionFlag) != None && !c.hasBuiltinVersionGroup && c.FindOptionByLongName("version") == nil {
+		c.addVersionGroup(p.showBuiltinVersion)
+		c.hasBuiltinVersionGroup = true
+	}
+
 	// Add built-in help group to all commands if necessary
 	if (p.Options & HelpFlag) != None {
-		p.addHelpGroups(p.showBuiltinHelp)
+		c.addHelpGroups(p.showBuiltinHelp)
+	}
+}
+
+// loadCommand creates the data of a lazily added command and readies its
+// options for parsing.
+func (p *Parser) loadCommand(c *Command) error {
+	if c.factory == nil {
+		return nil
+	}
+
+	if err := c.load(); err != nil {
+		return err
 	}
 
+	p.prepareCommand(c)
+	return nil
+}
+
+func (p *Parser) ParseFlagsArgs(args []string) error {
+	if p.internalError != nil {
+		return p.internalError
+	}
+
+	// Aliases and lazy commands are not checked when they are added
+	var dupErr *Error
+
+	p.eachCommand(func(c *Command) {
+		if dupErr == nil {
+			dupErr = checkDuplicateCommands(c.commands)
+		}
+	}, true)
+
+	if dupErr != nil {
+		return dupErr
+	}
+
+	p.prepareCommand(p.Command)
+
 	// TODO Figure out if handleCompletion is required here
 
 	p.state = &parseState{
-		args:    args,
-		retargs: make([]string, 0, len(args)),
+		args:       args,
+		allArgs:    args,
+		retargs:    make([]string, 0, len(args)),
+		terminator: -1,
 	}
 
 	p.fillParseState(p.state)
@@ -245,14 +494,39 @@ func (p *Parser) ParseFlagsArgs(args []string) error {
 		var err error
 		arg := p.state.pop()
 
+		if p.Trace != nil {
+			p.Trace("argument `%s'", arg)
+		}
+
+		if p.isArgsTerminator(arg) && p.state.terminator < 0 {
+			p.state.terminator = len(p.state.allArgs) - len(p.state.args) - 1
+		}
+
+		// When the active command has a passthrough field, then all
+		// the rest is assigned to that field instead
+		if p.isArgsTerminator(arg) && p.state.lookup.passthrough.IsValid() {
+			rest := make([]string, len(p.state.args))
+			copy(rest, p.state.args)
+
+			p.state.lookup.passthrough.Set(reflect.ValueOf(rest))
+			break
+		}
+
 		// When PassDoubleDash is set and we encounter a --, then
 		// simply append all the rest as arguments and break out
-		if (p.Options&PassDoubleDash) != None && arg == "--" {
+		if (p.Options&PassDoubleDash) != None && p.isArgsTerminator(arg) {
 			p.state.addArgs(p.state.args...)
 			break
 		}
 
 		if !argumentIsOption(arg) {
+			if (p.Options&StopAtFirstPositional) != None && p.state.lookup.commands[arg] == nil {
+				p.state.retargs = append(p.state.retargs, arg)
+				p.state.retargs = append(p.state.retargs, p.state.args...)
+
+				break
+			}
+
 			if (p.Options&PassAfterNonOption) != None && p.state.lookup.commands[arg] == nil {
 				// If PassAfterNonOption is set then all remaining arguments
 				// are considered positional
@@ -287,16 +561,31 @@ func (p *Parser) ParseFlagsArgs(args []string) error {
 
 		if err != nil {
 			ignoreUnknown := (p.Options & IgnoreUnknown) != None
+			passUnknown := (p.Options & PassUnknownAsArgs) != None
 			parseErr := wrapError(err)
 
-			if parseErr.Type != ErrUnknownFlag || (!ignoreUnknown && p.UnknownOptionHandler == nil) {
+			if parseErr.Type != ErrUnknownFlag || (!ignoreUnknown && !passUnknown && p.UnknownOptionHandler == nil) {
+				if p.Trace != nil {
+					p.Trace("error: %s", parseErr.Message)
+				}
+
 				p.state.err = parseErr
 				break
 			}
 
-			if ignoreUnknown {
+			if p.Trace != nil {
+				p.Trace("unknown flag `%s' not treated as an error", optname)
+			}
+
+			if passUnknown {
+				p.state.retargs = append(p.state.retargs, arg)
+
+				if islong && argument == nil && !p.state.eof() && !argumentIsOption(p.state.peek()) && !p.isArgsTerminator(p.state.peek()) {
+					p.state.retargs = append(p.state.retargs, p.state.pop())
+				}
+			} else if ignoreUnknown {
 				p.state.addArgs(arg)
-			} else if p.UnknownOptionHandler != nil {
+			} else if p.UnknownOptionHandler != nil && !p.validating {
 				modifiedArgs, err := p.UnknownOptionHandler(optname, strArgument{argument}, p.state.args)
 
 				if err != nil {
@@ -304,7 +593,7 @@ func (p *Parser) ParseFlagsArgs(args []string) error {
 					break
 				}
 
-				p.state.args = modifiedArgs
+				p.state.replaceArgs(modifiedArgs)
 			}
 		}
 	}
@@ -316,7 +605,9 @@ func (p *Parser) ParseFlagsArgs(args []string) error {
 // were added to the parser. On successful parsing of the arguments, the
 // remaining, non-option, arguments (if any) are returned. The returned error
 // indicates a parsing error and can be used with PrintError to display
-// contextual information on where the error occurred exactly.
+// contextual information on where the error occurred exactly. The arguments
+// must not include the program name, use ParseArgs0 to parse an os.Args style
+// list of arguments.
 //
 // When the common help group has been added (AddHelp) and either -h or --help
 // was specified in the command line arguments, a help message will be
@@ -324,17 +615,276 @@ func (p *Parser) ParseFlagsArgs(args []string) error {
 // Furthermore, the special error type ErrHelp is returned.
 // It is up to the caller to exit the program if so desired.
 func (p *Parser) ParseArgs(args []string) ([]string, error) {
+	var snapshot *parserSnapshot
+
+	if p.AtomicParse {
+		snapshot = p.snapshot()
+	}
+
 	err := p.ParseFlagsArgs(args)
 
 	if err != nil {
-		return nil, err
+		p.closeOpenedFiles()
+		snapshot.restore()
+		return nil, p.formatError(err)
 	}
 
 	if p.handleCompletion(args) {
 		return nil, nil
 	}
 
-	return p.Execute()
+	retargs, err := p.Execute()
+
+	if err != nil {
+		if flagsErr, ok := err.(*Error); !ok || (flagsErr.Type != ErrHelp && flagsErr.Type != ErrVersion) {
+			p.closeOpenedFiles()
+			snapshot.restore()
+		}
+	}
+
+	return retargs, err
+}
+
+// fieldSnapshot holds a deep copy of the value of a field bound by the parser.
+type fieldSnapshot struct {
+	field reflect.Value
+	value reflect.Value
+}
+
+// snapshotFields makes a deep copy of the values of all option, positional
+// argument and passthrough fields of the parser.
+func (p *Parser) snapshotFields() []fieldSnapshot {
+	var snapshot []fieldSnapshot
+
+	add := func(field reflect.Value) {
+		if field.IsValid() && field.CanSet() {
+			snapshot = append(snapshot, fieldSnapshot{field: field, value: deepCopy(field)})
+		}
+	}
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				add(option.value)
+			}
+
+			add(g.passthrough)
+		})
+
+		for _, arg := range c.args {
+			add(arg.value)
+		}
+	}, true)
+
+	return snapshot
+}
+
+func restoreFields(snapshot []fieldSnapshot) {
+	for _, s := range snapshot {
+		s.field.Set(s.value)
+	}
+}
+
+// parserSnapshot holds the field values, the option states and the active
+// commands of a parser, to undo a parse.
+type parserSnapshot struct {
+	fields  []fieldSnapshot
+	active  map[*Command]*Command
+	options map[*Option]Option
+	lazy    map[*Command]lazySnapshot
+}
+
+// lazySnapshot saves a command added with AddCommandLazy which has not been
+// loaded yet, to unload it again when restoring.
+type lazySnapshot struct {
+	command Command
+	group   Group
+}
+
+// snapshot saves the field values, the option states, the active commands
+// and the commands which are not loaded yet of the parser.
+func (p *Parser) snapshot() *parserSnapshot {
+	s := &parserSnapshot{
+		fields:  p.snapshotFields(),
+		active:  make(map[*Command]*Command),
+		options: make(map[*Option]Option),
+		lazy:    make(map[*Command]lazySnapshot),
+	}
+
+	p.eachCommand(func(c *Command) {
+		s.active[c] = c.Active
+
+		if c.factory != nil {
+			s.lazy[c] = lazySnapshot{command: *c, group: *c.Group}
+		}
+	}, true)
+
+	p.eachOption(func(c *Command, g *Group, option *Option) {
+		s.options[option] = *option
+	})
+
+	return s
+}
+
+// restore restores the parser to the state saved in the snapshot. Restoring
+// a nil snapshot does nothing.
+func (s *parserSnapshot) restore() {
+	if s == nil {
+		return
+	}
+
+	restoreFields(s.fields)
+
+	for c, l := range s.lazy {
+		*c.Group = l.group
+		*c = l.command
+	}
+
+	for c, a := range s.active {
+		c.Active = a
+	}
+
+	for option, saved := range s.options {
+		*option = saved
+	}
+}
+
+// deepCopy returns a copy of v which does not share any pointers, slices or
+// maps with v. Unexported struct fields and files are copied shallowly.
+func deepCopy(v reflect.Value) reflect.Value {
+	ret := reflect.New(v.Type()).Elem()
+
+	if v.Type() == fileType {
+		ret.Set(v)
+		return ret
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			ptr := reflect.New(v.Type().Elem())
+			ptr.Elem().Set(deepCopy(v.Elem()))
+			ret.Set(ptr)
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			ret.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+
+			for i := 0; i < v.Len(); i++ {
+				ret.Index(i).Set(deepCopy(v.Index(i)))
+			}
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			ret.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+
+			for _, key := range v.MapKeys() {
+				ret.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+			}
+		}
+	case reflect.Struct:
+		ret.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			if ret.Field(i).CanSet() {
+				ret.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+	default:
+		ret.Set(v)
+	}
+
+	return ret
+}
+
+// LastArgs returns the arguments given to the last parse, split at the point
+// where parsing stopped: consumed contains the arguments which have been
+// processed and remaining the arguments which have not been looked at (e.g.
+// the arguments after a double dash). If the parse failed, the argument
+// which caused the error is the first of the remaining arguments. Both are
+// nil if nothing has been parsed yet.
+func (p *Parser) LastArgs() (consumed []string, remaining []string) {
+	if p.state == nil {
+		return nil, nil
+	}
+
+	n := len(p.state.allArgs) - len(p.state.args)
+
+	if p.state.err != nil && n > 0 {
+		n--
+	}
+
+	consumed = append([]string{}, p.state.allArgs[:n]...)
+	remaining = append([]string{}, p.state.allArgs[n:]...)
+
+	return consumed, remaining
+}
+
+// Terminated returns whether a double dash (--), or the ArgsTerminator,
+// separating options from the remaining arguments was seen by the last
+// parse. This is reported regardless of the PassDoubleDash option.
+func (p *Parser) Terminated() bool {
+	return p.TerminatorIndex() >= 0
+}
+
+// TerminatorIndex returns the index of the first double dash (--), or the
+// ArgsTerminator, in the arguments given to the last parse, or -1 if there
+// was none. Arguments replaced by PreParse or the UnknownOptionHandler are
+// counted as they are by LastArgs.
+func (p *Parser) TerminatorIndex() int {
+	if p.state == nil {
+		return -1
+	}
+
+	return p.state.terminator
+}
+
+// EachOption calls f for every option of the parser, including hidden options
+// and the options of all (nested) commands. Commands are visited depth-first,
+// starting with the parser itself, and the options of each command are visited
+// group by group in declaration order. Commands added with AddCommandLazy are
+// only visited once they have been loaded.
+func (p *Parser) EachOption(f func(command *Command, group *Group, option *Option)) {
+	p.eachOption(f)
+}
+
+// ActiveCommand returns the innermost command selected while parsing, i.e.
+// the command which is executed, or nil if no command was selected.
+func (p *Parser) ActiveCommand() *Command {
+	path := p.ActivePath()
+
+	if len(path) < 2 {
+		return nil
+	}
+
+	return path[len(path)-1]
+}
+
+// OpenedFiles returns the files opened by the last parse for options of type
+// *os.File, io.Reader or io.Writer (see the open-mode tag), in the order of
+// the options. Closing these files is up to the caller, unless the parse
+// failed (with an error other than ErrHelp or ErrVersion), in which case
+// ParseArgs closes them and none are returned. The standard streams used for
+// the "-" path are not included.
+func (p *Parser) OpenedFiles() []*os.File {
+	var files []*os.File
+
+	p.eachOption(func(c *Command, g *Group, option *Option) {
+		files = append(files, option.opened...)
+	})
+
+	return files
+}
+
+// closeOpenedFiles closes the files opened by the last parse.
+func (p *Parser) closeOpenedFiles() {
+	p.eachOption(func(c *Command, g *Group, option *Option) {
+		for _, f := range option.opened {
+			f.Close()
+		}
+
+		option.opened = nil
+	})
 }
 
 func (p *Parser) GetCommand() interface{} {
@@ -344,10 +894,10 @@ func (p *Parser) GetCommand() interface{} {
 func (p *Parser) Execute() ([]string, error) {
 	var reterr error
 
-	if p.state.err != nil {
-		reterr = p.state.err
-	} else if len(p.state.command.commands) != 0 && !p.state.command.SubcommandsOptional {
-		reterr = p.state.estimateCommand()
+	if err := p.checkParse(); err != nil {
+		reterr = err
+	} else if err := p.afterParse(); err != nil {
+		reterr = err
 	} else if cmd, ok := p.state.command.data.(Commander); ok {
 		if p.CommandHandler != nil {
 			reterr = p.CommandHandler(cmd, p.state.retargs)
@@ -359,9 +909,11 @@ func (p *Parser) Execute() ([]string, error) {
 	}
 
 	if reterr != nil {
+		reterr = p.formatError(reterr)
+
 		var retargs []string
 
-		if ourErr, ok := reterr.(*Error); !ok || ourErr.Type != ErrHelp {
+		if ourErr, ok := reterr.(*Error); !ok || (ourErr.Type != ErrHelp && ourErr.Type != ErrVersion) {
 			retargs = append([]string{p.state.arg}, p.state.args...)
 		} else {
 			retargs = p.state.args
@@ -373,6 +925,109 @@ func (p *Parser) Execute() ([]string, error) {
 	return p.state.retargs, nil
 }
 
+// checkParse returns the error of the last parse, or checks whether the
+// parsed arguments are complete.
+func (p *Parser) checkParse() error {
+	if p.state.err != nil {
+		return p.state.err
+	}
+
+	if p.state.command.requiresSubcommand() {
+		return p.state.estimateCommand()
+	}
+
+	return p.checkCounts()
+}
+
+// Validate checks the command line arguments as ParseArgs would, returning
+// the same errors (e.g. for unknown flags, invalid choices or values which
+// cannot be converted), but without any side effects. The values of all
+// option, positional argument and passthrough fields, as well as the state
+// of the options and the active commands, are restored afterwards. Function
+// options are not called (although their arguments are still converted),
+// files of file options are not opened, and neither AfterParse nor the
+// Execute method of the command (or the CommandHandler) are called. Neither
+// are the Defaulters, the PreParse functions of the commands or the
+// UnknownOptionHandler (unknown options are skipped instead of being passed
+// to it). Commands added with AddCommandLazy are created to check their
+// arguments, and discarded again afterwards. Errors are not printed, and the
+// built-in help and version options have no effect.
+func (p *Parser) Validate(args []string) error {
+	snapshot := p.snapshot()
+	state := p.state
+
+	p.validating = true
+
+	defer func() {
+		p.validating = false
+		p.state = state
+
+		snapshot.restore()
+	}()
+
+	if err := p.ParseFlagsArgs(args); err != nil {
+		return p.formatError(err)
+	}
+
+	if err := p.checkParse(); err != nil {
+		return p.formatError(err)
+	}
+
+	return nil
+}
+
+// checkCounts checks the number of values of the options of the active
+// commands against their min and max tags.
+func (p *Parser) checkCounts() error {
+	var err error
+
+	for c := p.state.command; c != nil && err == nil; c, _ = c.parent.(*Command) {
+		c.eachGroup(func(g *Group) {
+			for _, option := range g.options {
+				if err == nil {
+					err = option.checkCount()
+				}
+			}
+		})
+	}
+
+	return err
+}
+
+// afterParse calls AfterParse on the data of all groups of the active
+// commands which implement AfterParser.
+func (p *Parser) afterParse() error {
+	var chain []*Command
+
+	for c := p.state.command; c != nil; c, _ = c.parent.(*Command) {
+		chain = append([]*Command{c}, chain...)
+	}
+
+	var err error
+
+	for _, c := range chain {
+		c.eachGroup(func(g *Group) {
+			if err != nil {
+				return
+			}
+
+			if a, ok := g.data.(AfterParser); ok {
+				err = a.AfterParse()
+			}
+		})
+
+		if err != nil {
+			if _, ok := err.(*Error); !ok {
+				err = newError(ErrMarshal, err.Error())
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *parseState) eof() bool {
 	return len(p.args) == 0
 }
@@ -396,6 +1051,15 @@ func (p *parseState) peek() string {
 	return p.args[0]
 }
 
+// replaceArgs replaces the remaining arguments, keeping the arguments
+// reported by LastArgs in line with them.
+func (p *parseState) replaceArgs(args []string) {
+	consumed := len(p.allArgs) - len(p.args)
+	p.allArgs = append(append([]string{}, p.allArgs[:consumed]...), args...)
+
+	p.args = args
+}
+
 func (p *parseState) estimateCommand() error {
 	commands := p.command.sortedVisibleCommands()
 	cmdnames := make([]string, len(commands))
@@ -433,6 +1097,9 @@ func (p *parseState) estimateCommand() error {
 			msg = fmt.Sprintf("Please specify one command of: %s or %s",
 				strings.Join(cmdnames[:len(cmdnames)-1], ", "),
 				cmdnames[len(cmdnames)-1])
+		} else {
+			// All commands are hidden
+			msg = "Please specify a command"
 		}
 	}
 
@@ -440,24 +1107,52 @@ func (p *parseState) estimateCommand() error {
 }
 
 func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg bool, argument *string) (err error) {
+	if option.Experimental && !p.AllowExperimental {
+		return newErrorf(ErrExperimental, "flag `%s' is experimental and not enabled", option)
+	}
+
 	if !option.canArgument() {
+		allowValue := (p.Options&AllowBoolValues) != None && option.isScalarBool()
+
 		if argument != nil {
-			return newErrorf(ErrNoArgumentForBool, "bool flag `%s' cannot have an argument", option)
-		}
+			if !allowValue {
+				if option.isCounter() {
+					return newErrorf(ErrNoArgumentForBool, "counter flag `%s' cannot have an argument", option)
+				}
+
+				return newErrorf(ErrNoArgumentForBool, "bool flag `%s' cannot have an argument", option)
+			}
 
-		err = option.Set(nil)
+			err = option.Set(argument)
+		} else if allowValue && canarg && !s.eof() && isBoolValue(s.peek()) {
+			arg := s.pop()
+			err = option.Set(&arg)
+		} else {
+			err = option.Set(nil)
+		}
 	} else if argument != nil || (canarg && !s.eof()) {
 		var arg string
 
 		if argument != nil {
 			arg = *argument
+
+			if arg == "" && option.isClearable() {
+				option.clear()
+				option.source = SourceArg
+
+				return nil
+			}
 		} else {
 			arg = s.pop()
 
 			if validationErr := option.isValidValue(arg); validationErr != nil {
 				return newErrorf(ErrExpectedArgument, validationErr.Error())
-			} else if p.Options&PassDoubleDash != 0 && arg == "--" {
-				return newErrorf(ErrExpectedArgument, "expected argument for flag `%s', but got double dash `--'", option)
+			} else if p.Options&PassDoubleDash != 0 && p.isArgsTerminator(arg) {
+				if arg == "--" {
+					return newErrorf(ErrExpectedArgument, "expected argument for flag `%s', but got double dash `--'", option)
+				}
+
+				return newErrorf(ErrExpectedArgument, "expected argument for flag `%s', but got terminator `%s'", option, arg)
 			}
 		}
 
@@ -468,6 +1163,10 @@ func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg
 		if err == nil {
 			err = option.Set(&arg)
 		}
+
+		if err == nil && argument == nil && option.isGreedy() {
+			err = p.parseGreedyValues(s, option)
+		}
 	} else if option.OptionalArgument {
 		option.empty()
 
@@ -478,6 +1177,8 @@ func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg
 				break
 			}
 		}
+	} else if len(option.Choices) != 0 {
+		err = newErrorf(ErrExpectedArgument, "expected argument for flag `%s'; valid values: %s", option, strings.Join(option.displayChoices(), ", "))
 	} else {
 		err = newErrorf(ErrExpectedArgument, "expected argument for flag `%s'", option)
 	}
@@ -486,11 +1187,59 @@ func (p *Parser) parseOption(s *parseState, name string, option *Option, canarg
 		if _, ok := err.(*Error); !ok {
 			err = p.marshalError(option, err)
 		}
+	} else {
+		option.source = SourceArg
+
+		if p.Trace != nil {
+			value, _ := convertToString(option.value, option.tag)
+			p.Trace("flag `%s' set to `%s'", option, value)
+		}
 	}
 
 	return err
 }
 
+// parseGreedyValues consumes consecutive non-option arguments as additional
+// values of a greedy slice option. Consumption stops at the first argument
+// that looks like an option, or at a double dash or the ArgsTerminator.
+func (p *Parser) parseGreedyValues(s *parseState, option *Option) error {
+	for !s.eof() {
+		arg := s.peek()
+
+		if argumentStartsOption(arg) || p.isArgsTerminator(arg) {
+			break
+		}
+
+		s.pop()
+
+		var err error
+
+		if option.tag.Get("unquote") != "false" {
+			arg, err = unquoteIfPossible(arg)
+		}
+
+		if err == nil {
+			err = option.Set(&arg)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isArgsTerminator returns whether arg separates the options from the
+// remaining arguments.
+func (p *Parser) isArgsTerminator(arg string) bool {
+	if p.ArgsTerminator == "" || p.ArgsTerminator == "--" {
+		return arg == "--"
+	}
+
+	return arg == p.ArgsTerminator || (arg == "--" && !p.DisableDoubleDash)
+}
+
 func (p *Parser) marshalError(option *Option, err error) *Error {
 	s := "invalid argument for flag `%s'"
 
@@ -512,11 +1261,42 @@ func (p *Parser) expectedType(option *Option) string {
 		return ""
 	}
 
+	if option.isSetter() {
+		return "path=value"
+	}
+
 	return valueType.String()
 }
 
 func (p *Parser) parseLong(s *parseState, name string, argument *string) error {
-	if option := s.lookup.longNames[name]; option != nil {
+	appending := false
+
+	// A value given with += is added to the values of an option with the
+	// append-operator tag, instead of replacing them
+	if argument != nil && strings.HasSuffix(name, "+") {
+		if option := s.lookup.longNames[name[:len(name)-1]]; option != nil && option.hasAppendOperator() {
+			name = name[:len(name)-1]
+			appending = true
+		}
+	}
+
+	option := s.lookup.longNames[name]
+
+	// An unambiguous prefix of a long name selects the option when prefix
+	// matching is enabled, exact matches always take precedence
+	if option == nil && name != "" && (p.Options&AllowPrefixMatch) != None {
+		var err error
+
+		if option, err = s.lookup.longPrefix(name); err != nil {
+			return err
+		}
+	}
+
+	if option != nil {
+		if option.hasAppendOperator() {
+			option.clearReferenceBeforeSet = !appending
+		}
+
 		// Only long options that are required can consume an argument
 		// from the argument list
 		canarg := !option.OptionalArgument
@@ -553,6 +1333,10 @@ func (p *Parser) parseShort(s *parseState, optname string, argument *string) err
 		shortname := string(c)
 
 		if option := s.lookup.shortNames[shortname]; option != nil {
+			if option.hasAppendOperator() {
+				option.clearReferenceBeforeSet = true
+			}
+
 			// Only the last short argument can consume an argument from
 			// the arguments list, and only if it's non optional
 			canarg := (i+utf8.RuneLen(c) == len(optname)) && !option.OptionalArgument
@@ -594,16 +1378,39 @@ func (p *parseState) addArgs(args ...string) error {
 
 func (p *Parser) parseNonOption(s *parseState) error {
 	if len(s.positional) > 0 {
+		if p.Trace != nil {
+			p.Trace("positional argument `%s' assigned to `%s'", s.arg, s.positional[0].Name)
+		}
 		return s.addArgs(s.arg)
 	}
 
 	if len(s.command.commands) > 0 && len(s.retargs) == 0 {
 		if cmd := s.lookup.commands[s.arg]; cmd != nil {
+			if err := p.loadCommand(cmd); err != nil {
+				s.err = err
+				return err
+			}
+
+			if p.Trace != nil {
+				p.Trace("command `%s' activated", cmd.Name)
+			}
+
 			s.command.Active = cmd
 			cmd.fillParseState(s)
 
+			if cmd.PreParse != nil && !p.validating {
+				args, err := cmd.PreParse(s.args)
+
+				if err != nil {
+					s.err = err
+					return err
+				}
+
+				s.replaceArgs(args)
+			}
+
 			return nil
-		} else if !s.command.SubcommandsOptional {
+		} else if s.command.requiresSubcommand() {
 			s.addArgs(s.arg)
 			return newErrorf(ErrUnknownCommand, "Unknown command `%s'", s.arg)
 		}
@@ -619,12 +1426,27 @@ func (p *Parser) showBuiltinHelp() error {
 	return newError(ErrHelp, b.String())
 }
 
+// formatError applies the ErrorFormatter, if any, to err.
+func (p *Parser) formatError(err error) error {
+	if flagsErr, ok := err.(*Error); ok && p.ErrorFormatter != nil {
+		return newError(flagsErr.Type, p.ErrorFormatter(flagsErr))
+	}
+
+	return err
+}
+
+func (p *Parser) showBuiltinVersion() error {
+	return newError(ErrVersion, p.Version)
+}
+
 func (p *Parser) printError(err error) error {
 	if err != nil && (p.Options&PrintErrors) != None {
 		flagsErr, ok := err.(*Error)
 
-		if ok && flagsErr.Type == ErrHelp {
+		if ok && (flagsErr.Type == ErrHelp || flagsErr.Type == ErrVersion) {
 			fmt.Fprintln(os.Stdout, err)
+		} else if p.ErrorWriter != nil {
+			fmt.Fprintln(p.ErrorWriter, err)
 		} else {
 			fmt.Fprintln(os.Stderr, err)
 		}
@@ -1,13 +1,18 @@
 package flags
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -425,6 +430,102 @@ func TestChoices(t *testing.T) {
 	assertString(t, opts.Choice, "v2")
 }
 
+func TestChoicesMissingValue(t *testing.T) {
+	var opts struct {
+		Level string `long:"level" choice:"info" choice:"warn" choice:"error"`
+		Range int    `long:"range" choice:"1..5"`
+		Value string `long:"value"`
+	}
+
+	assertParseFail(t, ErrExpectedArgument, "expected argument for flag `"+defaultLongOptDelimiter+"level'; valid values: info, warn, error", &opts, "--level")
+	assertParseFail(t, ErrExpectedArgument, "expected argument for flag `"+defaultLongOptDelimiter+"range'; valid values: 1-5", &opts, "--range")
+	assertParseFail(t, ErrExpectedArgument, "expected argument for flag `"+defaultLongOptDelimiter+"value'", &opts, "--value")
+}
+
+func TestChoicesRange(t *testing.T) {
+	var opts struct {
+		Level  int    `long:"level" choice:"1..5" choice:"10"`
+		Choice string `long:"choose" choice:"1..5"`
+	}
+
+	assertParseFail(t, ErrInvalidChoice, "Invalid value `6' for option `"+defaultLongOptDelimiter+"level'. Allowed values are: 1-5 or 10", &opts, "--level", "6")
+	assertParseFail(t, ErrInvalidChoice, "Invalid value `3' for option `"+defaultLongOptDelimiter+"choose'. Allowed values are: 1..5", &opts, "--choose", "3")
+
+	for _, level := range []string{"1", "3", "5", "10"} {
+		assertParseSuccess(t, &opts, "--level", level)
+		assertString(t, strconv.Itoa(opts.Level), level)
+	}
+
+	// Values are parsed with the same base handling as the conversion
+	for level, expected := range map[string]int{"0x3": 3, "04": 4, "0b101": 5} {
+		assertParseSuccess(t, &opts, "--level", level)
+
+		if opts.Level != expected {
+			t.Errorf("Expected level %s to be %d, but got %d", level, expected, opts.Level)
+		}
+	}
+
+	assertParseFail(t, ErrInvalidChoice, "Invalid value `0x6' for option `"+defaultLongOptDelimiter+"level'. Allowed values are: 1-5 or 10", &opts, "--level", "0x6")
+
+	var hexOpts struct {
+		Mask int `long:"mask" base:"16" choice:"a..f"`
+	}
+
+	assertParseSuccess(t, &hexOpts, "--mask", "c")
+
+	if hexOpts.Mask != 12 {
+		t.Errorf("Expected mask to be 12, but got %d", hexOpts.Mask)
+	}
+
+	assertParseFail(t, ErrInvalidChoice, "Invalid value `10' for option `"+defaultLongOptDelimiter+"mask'. Allowed values are: a-f", &hexOpts, "--mask", "10")
+
+	p := NewParser(&opts, None)
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), defaultLongOptDelimiter+"level"+string(defaultNameArgDelimiter)+"[1-5|10]") {
+		t.Errorf("Expected help to show the range, but got:\n%s", buf.String())
+	}
+}
+
+func TestSetChoices(t *testing.T) {
+	var opts struct {
+		Choice string `long:"choose" choice:"v1" choice:"v2"`
+	}
+
+	p := NewParser(&opts, None)
+	option := p.FindOptionByLongName("choose")
+
+	choices := []string{"a", "b", "c"}
+	option.SetChoices(choices)
+	choices[0] = "x"
+
+	assertStringArray(t, option.Choices, []string{"a", "b", "c"})
+
+	_, err := p.ParseArgs([]string{"--choose", "v1"})
+	assertError(t, err, ErrInvalidChoice, "Invalid value `v1' for option `"+defaultLongOptDelimiter+"choose'. Allowed values are: a, b or c")
+
+	if _, err := p.ParseArgs([]string{"--choose", "b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Choice, "b")
+
+	var buf bytes.Buffer
+	p.WriteHelp(&buf)
+
+	if !strings.Contains(buf.String(), defaultLongOptDelimiter+"choose"+string(defaultNameArgDelimiter)+"[a|b|c]") {
+		t.Errorf("Expected help to show the new choices, but got:\n%s", buf.String())
+	}
+
+	option.SetChoices(nil)
+
+	if _, err := p.ParseArgs([]string{"--choose", "anything"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestEmbedded(t *testing.T) {
 	type embedded struct {
 		V bool `short:"v"`
@@ -524,3 +625,1204 @@ func TestCommandHandler(t *testing.T) {
 
 	assertStringArray(t, executedArgs, []string{"arg1", "arg2"})
 }
+
+func TestOptionSource(t *testing.T) {
+	var opts struct {
+		Value   string `long:"value"`
+		Other   string `long:"other" default:"other"`
+		Verbose bool   `short:"v"`
+	}
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.ParseArgs([]string{"--value", "x", "-v"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string]OptionSource{
+		"value": SourceArg,
+		"other": SourceDefault,
+	}
+
+	for name, source := range tests {
+		if got := p.FindOptionByLongName(name).Source(); got != source {
+			t.Errorf("Expected source %s for %s, but got %s", source, name, got)
+		}
+	}
+
+	if got := p.FindOptionByShortName('v').Source(); got != SourceArg {
+		t.Errorf("Expected source %s for v, but got %s", SourceArg, got)
+	}
+}
+
+func TestFuncCallbackOrder(t *testing.T) {
+	var tests = []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--version", "--license"}, []string{"version", "license"}},
+		{[]string{"--license", "--version"}, []string{"license", "version"}},
+		{[]string{"--license", "--version", "--license"}, []string{"license", "version", "license"}},
+	}
+
+	for _, test := range tests {
+		var calls []string
+
+		var opts struct {
+			Version func() error `long:"version"`
+			License func() error `long:"license"`
+		}
+
+		opts.Version = func() error {
+			calls = append(calls, "version")
+			return nil
+		}
+
+		opts.License = func() error {
+			calls = append(calls, "license")
+			return nil
+		}
+
+		assertParseSuccess(t, &opts, test.args...)
+		assertStringArray(t, calls, test.expected)
+	}
+}
+
+func TestFuncCallbackFirstError(t *testing.T) {
+	var calls []string
+
+	var opts struct {
+		Version func() error `long:"version"`
+		License func() error `long:"license"`
+	}
+
+	opts.Version = func() error {
+		calls = append(calls, "version")
+		return errors.New("version failed")
+	}
+
+	opts.License = func() error {
+		calls = append(calls, "license")
+		return errors.New("license failed")
+	}
+
+	p := NewParser(&opts, None)
+	_, err := p.ParseArgs([]string{"--version", "--license"})
+
+	assertError(t, err, ErrMarshal, "invalid argument for flag `"+defaultLongOptDelimiter+"version': version failed")
+
+	assertStringArray(t, calls, []string{"version"})
+}
+
+func TestPassthrough(t *testing.T) {
+	var opts struct {
+		Value bool `short:"v"`
+
+		Positional struct {
+			Pod string
+		} `positional-args:"yes"`
+
+		Command []string `passthrough:"yes"`
+	}
+
+	ret := assertParseSuccess(t, &opts, "-v", "mypod", "extra", "--", "ls", "-l", "--", "x")
+
+	assertStringArray(t, ret, []string{"extra"})
+	assertString(t, opts.Positional.Pod, "mypod")
+	assertStringArray(t, opts.Command, []string{"ls", "-l", "--", "x"})
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+}
+
+func TestPassthroughCommand(t *testing.T) {
+	var opts struct {
+		Exec struct {
+			Command []string `passthrough:"yes"`
+		} `command:"exec"`
+	}
+
+	p := NewParser(&opts, None)
+	ret, err := p.ParseArgs([]string{"exec", "--", "echo", "hi"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+	assertStringArray(t, opts.Exec.Command, []string{"echo", "hi"})
+}
+
+func TestPassthroughInvalidType(t *testing.T) {
+	var opts struct {
+		Command string `passthrough:"yes"`
+	}
+
+	assertParseFail(t, ErrInvalidTag, "passthrough field `Command' must be of type []string", &opts)
+}
+
+func TestEachOption(t *testing.T) {
+	var opts struct {
+		Verbose bool `short:"v" long:"verbose"`
+		Secret  bool `long:"secret" hidden:"yes"`
+
+		Group struct {
+			Level int `long:"level"`
+		} `group:"Group Options"`
+
+		Add struct {
+			Force bool `long:"force"`
+
+			Sub struct {
+				Dry bool `long:"dry"`
+			} `command:"sub"`
+		} `command:"add"`
+
+		Remove struct {
+			All bool `long:"all"`
+		} `command:"rm"`
+	}
+
+	p := NewParser(&opts, None)
+
+	var visited []string
+
+	p.EachOption(func(command *Command, group *Group, option *Option) {
+		visited = append(visited, command.Name+"/"+group.ShortDescription+"/"+option.LongName)
+	})
+
+	assertStringArray(t, visited, []string{
+		p.Name + "/Application Options/verbose",
+		p.Name + "/Application Options/secret",
+		p.Name + "/Group Options/level",
+		"add//force",
+		"sub//dry",
+		"rm//all",
+	})
+}
+
+func TestParseArgs0(t *testing.T) {
+	var opts struct {
+		Value bool `short:"v"`
+	}
+
+	p := NewParser(&opts, None)
+	ret, err := p.ParseArgs0([]string{"/usr/bin/app", "-v", "rest"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"rest"})
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+
+	ret, err = p.ParseArgs0(nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{})
+}
+
+func TestParseCommandLine(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	var opts struct {
+		Value bool `short:"v"`
+	}
+
+	os.Args = []string{"/usr/bin/app", "-v", "rest"}
+
+	p := NewParser(&opts, None)
+	ret, err := p.ParseCommandLine()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"rest"})
+
+	if !opts.Value {
+		t.Errorf("Expected Value to be true")
+	}
+}
+
+type defaulterOptions struct {
+	Host  string   `long:"host"`
+	Port  int      `long:"port" default:"1"`
+	Paths []string `long:"path"`
+
+	Serve defaulterCommand `command:"serve"`
+}
+
+func (o *defaulterOptions) SetDefaults() {
+	o.Host = "localhost"
+	o.Port = 8080
+	o.Paths = []string{"/a", "/b"}
+}
+
+type defaulterCommand struct {
+	Workers int `long:"workers"`
+}
+
+func (c *defaulterCommand) SetDefaults() {
+	c.Workers = 4
+}
+
+func TestDefaulter(t *testing.T) {
+	var opts defaulterOptions
+
+	p := NewParser(&opts, None)
+	_, err := p.ParseArgs([]string{"--host", "example.com", "--path", "/c", "serve"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Host, "example.com")
+	assertStringArray(t, opts.Paths, []string{"/c"})
+
+	if opts.Port != 8080 {
+		t.Errorf("Expected Port to be 8080, but got %v", opts.Port)
+	}
+
+	if opts.Serve.Workers != 4 {
+		t.Errorf("Expected Workers to be 4, but got %v", opts.Serve.Workers)
+	}
+
+	port := p.FindOptionByLongName("port")
+
+	if port.IsSet() {
+		t.Errorf("Expected port not to be set")
+	}
+
+	assertString(t, port.defaultLiteral, "8080")
+	assertString(t, p.FindOptionByLongName("host").defaultLiteral, "localhost")
+
+	// The defaults are applied again on the next parse
+	p.SubcommandsOptional = true
+	opts.Port = 0
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Host, "localhost")
+	assertStringArray(t, opts.Paths, []string{"/a", "/b"})
+	assertString(t, port.defaultLiteral, "8080")
+}
+
+type changingDefaulterOptions struct {
+	Level int      `long:"level" default:"1"`
+	List  []string `long:"list"`
+
+	setLevel bool
+}
+
+func (o *changingDefaulterOptions) SetDefaults() {
+	if o.setLevel {
+		o.Level = 3
+	}
+
+	if len(o.List) != 0 {
+		o.List[0] = "changed"
+	}
+}
+
+func TestDefaulterRecomputed(t *testing.T) {
+	opts := changingDefaulterOptions{
+		List:     []string{"a", "b"},
+		setLevel: true,
+	}
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	level := p.FindOptionByLongName("level")
+	list := p.FindOptionByLongName("list")
+
+	if !level.IsSetDefault() {
+		t.Errorf("Expected level to be set by the defaulter")
+	}
+
+	assertString(t, level.defaultLiteral, "3")
+
+	// Changes made in place to a slice are detected as well
+	if !list.IsSetDefault() {
+		t.Errorf("Expected list to be set by the defaulter")
+	}
+
+	assertString(t, list.defaultLiteral, "[changed, b]")
+
+	// The defaulter no longer changes the values on the next parse
+	opts.setLevel = false
+	opts.Level = 0
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if level.IsSetDefault() || list.IsSetDefault() {
+		t.Errorf("Expected the options not to be set by the defaulter")
+	}
+
+	assertString(t, level.defaultLiteral, "1")
+}
+
+type afterParseOptions struct {
+	Name  string `long:"name"`
+	calls *[]string
+
+	Run afterParseCommand `command:"run"`
+}
+
+func (o *afterParseOptions) AfterParse() error {
+	if o.Name == "" {
+		return errors.New("name must not be empty")
+	}
+
+	o.Name = strings.ToLower(o.Name)
+	*o.calls = append(*o.calls, "options")
+
+	return nil
+}
+
+type afterParseCommand struct {
+	Jobs  int `long:"jobs"`
+	calls *[]string
+}
+
+func (c *afterParseCommand) AfterParse() error {
+	*c.calls = append(*c.calls, "command")
+	return nil
+}
+
+func (c *afterParseCommand) Execute(args []string) error {
+	*c.calls = append(*c.calls, "execute")
+	return nil
+}
+
+func TestOptionIsSet(t *testing.T) {
+	var opts defaulterOptions
+
+	p := NewParser(&opts, None)
+	_, err := p.ParseArgs([]string{"--host", "example.com", "serve"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	host := p.FindOptionByLongName("host")
+	port := p.FindOptionByLongName("port")
+
+	if !host.IsSet() || host.IsSetDefault() {
+		t.Errorf("Expected host to be set, and not to be the default")
+	}
+
+	if port.IsSet() || !port.IsSetDefault() {
+		t.Errorf("Expected port not to be set, and to be the default")
+	}
+
+	// The state is recomputed on every parse
+	_, err = p.ParseArgs([]string{"--port", "9090", "serve"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if host.IsSet() || !host.IsSetDefault() {
+		t.Errorf("Expected host not to be set, and to be the default")
+	}
+
+	if !port.IsSet() || port.IsSetDefault() {
+		t.Errorf("Expected port to be set, and not to be the default")
+	}
+
+	var plain struct {
+		Value int `long:"value" default:"1"`
+	}
+
+	p = NewParser(&plain, None)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if value := p.FindOptionByLongName("value"); value.IsSet() || value.IsSetDefault() {
+		t.Errorf("Expected value neither to be set nor to be the default")
+	}
+}
+
+func TestAfterParse(t *testing.T) {
+	var calls []string
+
+	opts := afterParseOptions{calls: &calls}
+	opts.Run.calls = &calls
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.ParseArgs([]string{"--name", "Test", "run", "--jobs", "2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Name, "test")
+	assertStringArray(t, calls, []string{"options", "command", "execute"})
+
+	calls = nil
+
+	_, err := p.ParseArgs([]string{"--name=", "run"})
+
+	assertError(t, err, ErrMarshal, "name must not be empty")
+	assertStringArray(t, calls, []string{})
+}
+
+func TestErrorWriter(t *testing.T) {
+	var opts = struct {
+		Value bool `short:"v"`
+	}{}
+
+	var b bytes.Buffer
+
+	p := NewParser(&opts, PrintErrors)
+	p.ErrorWriter = &b
+
+	_, err := p.ParseArgs([]string{"--unknown"})
+
+	assertError(t, err, ErrUnknownFlag, "unknown flag `unknown'")
+	assertString(t, b.String(), "unknown flag `unknown'\n")
+}
+
+func TestAtomicParse(t *testing.T) {
+	type server struct {
+		Port int
+	}
+
+	var opts = struct {
+		Name    string            `long:"name"`
+		Values  []string          `long:"value"`
+		Labels  map[string]string `long:"label"`
+		Count   *int              `long:"count"`
+		Server  *server           `long:"server" setter:"yes"`
+		Verbose bool              `short:"v"`
+
+		Positional struct {
+			Rest []string
+		} `positional-args:"yes"`
+	}{
+		Name:   "name",
+		Values: []string{"a"},
+		Labels: map[string]string{"a": "b"},
+		Count:  new(int),
+		Server: &server{Port: 80},
+	}
+
+	*opts.Count = 1
+
+	p := NewParser(&opts, None)
+	p.AtomicParse = true
+
+	_, err := p.ParseArgs([]string{"--name", "other", "--value", "b", "--label", "c:d", "--count", "2", "--server", "port=8080", "-v", "rest", "--unknown"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `unknown'")
+
+	assertString(t, opts.Name, "name")
+	assertStringArray(t, opts.Values, []string{"a"})
+	assertStringArray(t, opts.Positional.Rest, nil)
+
+	if len(opts.Labels) != 1 || opts.Labels["a"] != "b" {
+		t.Errorf("Expected Labels to be restored, but got %v", opts.Labels)
+	}
+
+	if *opts.Count != 1 {
+		t.Errorf("Expected Count to be restored, but got %d", *opts.Count)
+	}
+
+	if opts.Server.Port != 80 {
+		t.Errorf("Expected Server.Port to be restored, but got %d", opts.Server.Port)
+	}
+
+	if opts.Verbose {
+		t.Errorf("Expected Verbose to be restored")
+	}
+
+	name := p.FindOptionByLongName("name")
+
+	if name.IsSet() || name.Source() != SourceDefault {
+		t.Errorf("Expected the state of the name option to be restored")
+	}
+
+	if _, err := p.ParseArgs([]string{"--name", "other", "--count", "2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertString(t, opts.Name, "other")
+
+	if *opts.Count != 2 {
+		t.Errorf("Expected Count to be 2, but got %d", *opts.Count)
+	}
+
+	// A failed parse leaves the state of the previous parse
+	_, err = p.ParseArgs([]string{"--name", "third", "--value", "x", "--unknown"})
+	assertError(t, err, ErrUnknownFlag, "unknown flag `unknown'")
+
+	assertString(t, opts.Name, "other")
+
+	if !name.IsSet() || name.Source() != SourceArg {
+		t.Errorf("Expected the name option to be set by the previous parse")
+	}
+
+	if p.FindOptionByLongName("value").IsSet() {
+		t.Errorf("Expected the value option not to be set")
+	}
+}
+
+func TestAtomicParseCommandAndFiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+
+	if err := ioutil.WriteFile(input, []byte("input"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts = struct {
+		Input *os.File `long:"input"`
+
+		Command struct {
+			Output *os.File `long:"output" open-mode:"write"`
+			Level  int      `long:"level"`
+		} `command:"command"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.AtomicParse = true
+
+	_, err := p.ParseArgs([]string{"--input", input, "command", "--output", filepath.Join(dir, "output"), "--level", "x"})
+
+	if !IsMarshal(err) {
+		t.Fatalf("Expected a marshal error, but got %v", err)
+	}
+
+	if p.Active != nil {
+		t.Errorf("Expected no active command, but got %s", p.Active.Name)
+	}
+
+	if opts.Input != nil || opts.Command.Output != nil {
+		t.Errorf("Expected the file options to be restored")
+	}
+
+	if files := p.OpenedFiles(); len(files) != 0 {
+		t.Errorf("Expected no opened files, but got %d", len(files))
+	}
+}
+
+func TestOpenedFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	input := filepath.Join(dir, "input")
+	output := filepath.Join(dir, "output")
+	log := filepath.Join(dir, "log")
+
+	if err := ioutil.WriteFile(input, []byte("input"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(log, []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts = struct {
+		Input  io.Reader `long:"input"`
+		Output io.Writer `long:"output"`
+		Log    *os.File  `long:"log" open-mode:"append"`
+		Stdin  io.Reader `long:"stdin"`
+		Stdout *os.File  `long:"stdout" open-mode:"write"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	_, err := p.ParseArgs([]string{"--input", input, "--output", output, "--log", log, "--stdin", "-", "--stdout", "-"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := p.OpenedFiles()
+
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 opened files, but got %d", len(files))
+	}
+
+	data, err := ioutil.ReadAll(opts.Input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertString(t, string(data), "input")
+
+	fmt.Fprint(opts.Output, "output")
+	fmt.Fprint(opts.Log, "second\n")
+
+	if opts.Stdin != os.Stdin {
+		t.Errorf("Expected - to refer to stdin")
+	}
+
+	if opts.Stdout != os.Stdout {
+		t.Errorf("Expected - to refer to stdout")
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, _ = ioutil.ReadFile(output)
+	assertString(t, string(data), "output")
+
+	data, _ = ioutil.ReadFile(log)
+	assertString(t, string(data), "first\nsecond\n")
+
+	_, err = p.ParseArgs([]string{"--input", filepath.Join(dir, "missing")})
+
+	if !IsMarshal(err) {
+		t.Errorf("Expected a marshal error, but got %v", err)
+	}
+
+	if files := p.OpenedFiles(); len(files) != 0 {
+		t.Errorf("Expected no opened files after a failed parse, but got %d", len(files))
+	}
+}
+
+func TestOpenedFilesReparse(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+
+	if err := ioutil.WriteFile(input, []byte("input"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts = struct {
+		Input   *os.File `long:"input"`
+		Verbose bool     `short:"v"`
+		Level   int      `long:"level"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.ParseArgs([]string{"--input", input}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := p.OpenedFiles()
+
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 opened file, but got %d", len(files))
+	}
+
+	files[0].Close()
+
+	if _, err := p.ParseArgs([]string{"-v"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if files := p.OpenedFiles(); len(files) != 0 {
+		t.Errorf("Expected no opened files, but got %d", len(files))
+	}
+
+	// The file opened by a failed parse is closed by the parser
+	_, err := p.ParseArgs([]string{"--input", input, "--level", "x"})
+
+	if !IsMarshal(err) {
+		t.Fatalf("Expected a marshal error, but got %v", err)
+	}
+
+	if files := p.OpenedFiles(); len(files) != 0 {
+		t.Errorf("Expected no opened files, but got %d", len(files))
+	}
+
+	if _, err := opts.Input.Stat(); err == nil {
+		t.Errorf("Expected the file opened by the failed parse to be closed")
+	}
+}
+
+func TestOpenModeInvalid(t *testing.T) {
+	var opts = struct {
+		Log *os.File `long:"log" open-mode:"overwrite"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "invalid open-mode `overwrite' for flag `log'", &opts)
+}
+
+type cloneOptions struct {
+	Verbose []bool `short:"v"`
+
+	Group struct {
+		Name string `long:"name"`
+	} `group:"Group Options"`
+
+	Pointer *struct {
+		Value int `long:"value"`
+	} `group:"Pointer Options"`
+
+	Command struct {
+		Force bool `long:"force"`
+
+		Positional struct {
+			Target string
+			Rest   []string
+		} `positional-args:"yes"`
+	} `command:"command"`
+}
+
+func TestClone(t *testing.T) {
+	var opts cloneOptions
+
+	p := NewParser(&opts, Default&^PrintErrors)
+
+	var wg sync.WaitGroup
+
+	results := make([]cloneOptions, 10)
+
+	for i := range results {
+		c, err := p.Clone(&results[i])
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		wg.Add(1)
+
+		go func(i int, c *Parser) {
+			defer wg.Done()
+
+			name := strconv.Itoa(i)
+			_, err := c.ParseArgs([]string{"-v", "--name", name, "--value", name, "command", "--force", "target", "a", "b"})
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if c.Active == nil || c.Active.Name != "command" {
+				t.Errorf("Expected command to be active")
+			}
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	for i, res := range results {
+		name := strconv.Itoa(i)
+
+		assertBoolArray(t, res.Verbose, []bool{true})
+		assertString(t, res.Group.Name, name)
+
+		if res.Pointer == nil || res.Pointer.Value != i {
+			t.Errorf("Expected pointer group value %d, but got %v", i, res.Pointer)
+		}
+
+		if !res.Command.Force {
+			t.Errorf("Expected force to be set")
+		}
+
+		assertString(t, res.Command.Positional.Target, "target")
+		assertStringArray(t, res.Command.Positional.Rest, []string{"a", "b"})
+	}
+
+	if len(opts.Verbose) != 0 || opts.Group.Name != "" || opts.Pointer.Value != 0 || opts.Command.Force {
+		t.Errorf("Expected original options to be untouched, but got %+v", opts)
+	}
+
+	if p.Active != nil {
+		t.Errorf("Expected original parser to have no active command")
+	}
+}
+
+func TestCloneInvalid(t *testing.T) {
+	var opts cloneOptions
+
+	p := NewParser(&opts, None)
+
+	if _, err := p.Clone(opts); err != ErrNotPointerToStruct {
+		t.Errorf("Expected ErrNotPointerToStruct, but got %v", err)
+	}
+
+	var other defaultOptions
+
+	if _, err := p.Clone(&other); err == nil {
+		t.Errorf("Expected error for data of a different type")
+	}
+
+	var extra struct {
+		Extra bool `long:"extra"`
+	}
+
+	p.AddGroup("Extra", "", &extra)
+
+	_, err := p.Clone(&cloneOptions{})
+	assertError(t, err, ErrUnknown, "cannot clone group `Extra' which is not part of the parser data")
+}
+
+type validateCommand struct {
+	Force    bool `long:"force"`
+	executed bool
+}
+
+func (c *validateCommand) Execute(args []string) error {
+	c.executed = true
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	called := false
+
+	var opts struct {
+		Value  int       `long:"value"`
+		Color  string    `long:"color" choice:"red" choice:"blue"`
+		List   []string  `long:"list"`
+		Call   func(int) `long:"call"`
+		Output *os.File  `long:"output" open-mode:"write"`
+
+		Command validateCommand `command:"command"`
+	}
+
+	opts.Value = 1
+	opts.List = []string{"a"}
+	opts.Call = func(int) {
+		called = true
+	}
+
+	p := NewParser(&opts, None)
+	output := filepath.Join(t.TempDir(), "output")
+
+	err := p.Validate([]string{"--value", "2", "--list", "b", "--call", "3", "--output", output, "command", "--force"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Value != 1 || opts.Command.Force || opts.Command.executed || called {
+		t.Errorf("Expected options to be untouched, but got %+v", opts)
+	}
+
+	assertStringArray(t, opts.List, []string{"a"})
+
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected output file not to be created")
+	}
+
+	if p.Active != nil || p.FindOptionByLongName("value").IsSet() {
+		t.Errorf("Expected parser state to be untouched")
+	}
+
+	tests := []struct {
+		args []string
+		typ  ErrorType
+	}{
+		{[]string{"--unknown", "command"}, ErrUnknownFlag},
+		{[]string{"--value", "x", "command"}, ErrMarshal},
+		{[]string{"--call", "x", "command"}, ErrMarshal},
+		{[]string{"--color", "green", "command"}, ErrInvalidChoice},
+		{[]string{"--value", "2"}, ErrCommandRequired},
+	}
+
+	for _, test := range tests {
+		err := p.Validate(test.args)
+
+		if !isErrorType(err, test.typ) {
+			t.Errorf("Expected %s error for %v, but got %v", test.typ, test.args, err)
+		}
+	}
+
+	if opts.Value != 1 {
+		t.Errorf("Expected Value to be untouched, but got %d", opts.Value)
+	}
+}
+
+func TestValidateCallbacks(t *testing.T) {
+	var opts struct {
+		Value int `long:"value"`
+
+		Command struct {
+			Force bool `long:"force"`
+		} `command:"command"`
+	}
+
+	var calls []string
+
+	p := NewParser(&opts, None)
+
+	p.UnknownOptionHandler = func(option string, arg SplitArgument, args []string) ([]string, error) {
+		calls = append(calls, "unknown "+option)
+		return args, nil
+	}
+
+	p.Find("command").PreParse = func(args []string) ([]string, error) {
+		calls = append(calls, "preparse")
+		return args, nil
+	}
+
+	lazy, err := p.AddCommandLazy("lazy", "Lazy command", "", func() interface{} {
+		return &lazyDefaulterCommand{}
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := p.Validate([]string{"--unknown", "command", "--force"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := p.Validate([]string{"lazy", "--jobs", "2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("Expected no callbacks to be called, but got %v", calls)
+	}
+
+	if lazy.factory == nil || lazy.data != nil || len(lazy.Options()) != 0 {
+		t.Errorf("Expected the lazy command not to be loaded after validating")
+	}
+
+	if _, err := p.ParseArgs([]string{"--unknown", "command", "--force"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, calls, []string{"unknown unknown", "preparse"})
+}
+
+func TestLastArgs(t *testing.T) {
+	var opts struct {
+		Value   int  `long:"value"`
+		Verbose bool `short:"v"`
+	}
+
+	p := NewParser(&opts, PassDoubleDash)
+
+	consumed, remaining := p.LastArgs()
+
+	if consumed != nil || remaining != nil {
+		t.Errorf("Expected no arguments before parsing")
+	}
+
+	ret, err := p.ParseArgs([]string{"-v", "a", "--", "b", "-v"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, ret, []string{"a", "b", "-v"})
+
+	consumed, remaining = p.LastArgs()
+	assertStringArray(t, consumed, []string{"-v", "a", "--"})
+	assertStringArray(t, remaining, []string{"b", "-v"})
+
+	_, err = p.ParseArgs([]string{"-v", "--value", "x", "b"})
+
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+
+	consumed, remaining = p.LastArgs()
+	assertStringArray(t, consumed, []string{"-v", "--value"})
+	assertStringArray(t, remaining, []string{"x", "b"})
+
+	_, err = p.ParseArgs([]string{"-v", "--unknown", "b"})
+
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+
+	consumed, remaining = p.LastArgs()
+	assertStringArray(t, consumed, []string{"-v"})
+	assertStringArray(t, remaining, []string{"--unknown", "b"})
+
+	p.UnknownOptionHandler = func(option string, arg SplitArgument, args []string) ([]string, error) {
+		return append([]string{"--value", "2"}, args...), nil
+	}
+
+	_, err = p.ParseArgs([]string{"--unknown", "b", "--unknown2=", "c"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	consumed, remaining = p.LastArgs()
+	assertStringArray(t, consumed, []string{"--unknown", "--value", "2", "b", "--unknown2=", "--value", "2", "c"})
+	assertStringArray(t, remaining, []string{})
+}
+
+func TestTrace(t *testing.T) {
+	var opts defaulterOptions
+	var lines []string
+
+	p := NewParser(&opts, None)
+	p.Trace = func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	_, err := p.ParseArgs([]string{"--port", "9090", "serve", "--workers=2"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertStringArray(t, lines, []string{
+		"applying defaults of *flags.defaulterOptions",
+		"applying defaults of *flags.defaulterCommand",
+		"argument `--port'",
+		"flag `" + defaultLongOptDelimiter + "port' set to `9090'",
+		"argument `serve'",
+		"command `serve' activated",
+		"argument `--workers=2'",
+		"flag `" + defaultLongOptDelimiter + "workers' set to `2'",
+	})
+
+	lines = nil
+
+	_, err = p.ParseArgs([]string{"--unknown"})
+
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+
+	assertString(t, lines[len(lines)-1], "error: unknown flag `unknown'")
+}
+
+func TestWriteConfigJSON(t *testing.T) {
+	var opts = struct {
+		Verbose []bool        `short:"v" long:"verbose"`
+		Name    string        `long:"name"`
+		Timeout time.Duration `long:"timeout"`
+		Flag    bool          `short:"f"`
+
+		Group struct {
+			Level int `long:"level"`
+		} `group:"Output" namespace:"output"`
+
+		Add struct {
+			Tags map[string]string `long:"tag"`
+		} `command:"add"`
+	}{}
+
+	p := NewParser(&opts, Default)
+
+	if _, err := p.ParseArgs([]string{"-vv", "--output.level", "3", "add", "--tag", "a:b"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := p.WriteConfigJSON(&buf, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertDiff(t, buf.String(), `{
+  "Application Options": {
+    "Output": {
+      "level": 3
+    },
+    "verbose": [
+      true,
+      true
+    ]
+  },
+  "add": {
+    "tag": {
+      "a": "b"
+    }
+  }
+}
+`, "config")
+
+	buf.Reset()
+
+	if err := p.WriteConfigJSON(&buf, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertDiff(t, buf.String(), `{
+  "Application Options": {
+    "Output": {
+      "level": 3
+    },
+    "f": false,
+    "name": "",
+    "timeout": 0,
+    "verbose": [
+      true,
+      true
+    ]
+  },
+  "add": {
+    "tag": {
+      "a": "b"
+    }
+  }
+}
+`, "config with defaults")
+}
+
+func TestWriteConfigJSONKeys(t *testing.T) {
+	var opts = struct {
+		Name string `long:"name"`
+	}{}
+
+	var unnamed = struct {
+		Level int `long:"level"`
+	}{}
+
+	p := NewParser(&opts, None)
+	p.Groups()[0].AddGroup("", "", &unnamed)
+
+	if _, err := p.ParseArgs([]string{"--name", "a", "--level", "2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := p.WriteConfigJSON(&buf, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertDiff(t, buf.String(), `{
+  "Application Options": {
+    "level": 2,
+    "name": "a"
+  }
+}
+`, "config")
+
+	var conflicting = struct {
+		Output string `long:"Output"`
+
+		Group struct {
+			Level int `long:"level"`
+		} `group:"Output"`
+	}{}
+
+	p = NewParser(&conflicting, None)
+
+	if _, err := p.ParseArgs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf.Reset()
+
+	err := p.WriteConfigJSON(&buf, false)
+	assertError(t, err, ErrUnknown, "cannot write config: flag `"+defaultLongOptDelimiter+"Output' and group `Output' both use the key `Output'")
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, but got:\n%s", buf.String())
+	}
+}
@@ -184,3 +184,75 @@ func TestShortOptionalFalsy2(t *testing.T) {
 	assertStringArray(t, ret, []string{})
 	assertString(t, opts.Value, "f")
 }
+
+func TestShortCounter(t *testing.T) {
+	var opts = struct {
+		Verbose int `short:"v" long:"verbose" counter:"yes"`
+	}{}
+
+	ret := assertParseSuccess(t, &opts, "-vvv")
+
+	assertStringArray(t, ret, []string{})
+
+	if opts.Verbose != 3 {
+		t.Errorf("Expected Verbose to be 3, but got %d", opts.Verbose)
+	}
+
+	opts.Verbose = 5
+
+	assertParseSuccess(t, &opts, "-v", "-v", "--verbose")
+
+	if opts.Verbose != 3 {
+		t.Errorf("Expected Verbose to be 3, but got %d", opts.Verbose)
+	}
+}
+
+func TestShortCounterArgument(t *testing.T) {
+	var opts = struct {
+		Verbose int `long:"verbose" counter:"yes"`
+	}{}
+
+	assertParseFail(t, ErrNoArgumentForBool, "counter flag `"+defaultLongOptDelimiter+"verbose' cannot have an argument", &opts, "--verbose=2")
+}
+
+func TestShortCounterInvalidType(t *testing.T) {
+	var opts = struct {
+		Verbose string `long:"verbose" counter:"yes"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "counter flag `verbose' must be an integer", &opts, "--verbose")
+}
+
+func TestShortAliases(t *testing.T) {
+	var opts = struct {
+		Edit []bool `short:"e" short-aliases:"x" short-aliases:"y" long:"edit"`
+	}{}
+
+	p, ret := assertParserSuccess(t, &opts, "-e", "-xy")
+
+	assertStringArray(t, ret, []string{})
+	assertBoolArray(t, opts.Edit, []bool{true, true, true})
+
+	option := p.FindOptionByShortName('x')
+
+	if option == nil || option.LongName != "edit" {
+		t.Errorf("Expected to find option `edit' by its short alias")
+	}
+}
+
+func TestShortAliasesDuplicate(t *testing.T) {
+	var opts = struct {
+		Edit    bool `short:"e" short-aliases:"x"`
+		Extract bool `short:"x"`
+	}{}
+
+	assertParseFail(t, ErrDuplicatedFlag, "option `"+string(defaultShortOptDelimiter)+"x' uses the same short name as option `"+string(defaultShortOptDelimiter)+"e'", &opts)
+}
+
+func TestShortAliasesWithoutShort(t *testing.T) {
+	var opts = struct {
+		Edit bool `long:"edit" short-aliases:"x"`
+	}{}
+
+	assertParseFail(t, ErrInvalidTag, "short aliases `x' require a short name", &opts)
+}
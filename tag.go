@@ -0,0 +1,226 @@
+package flags
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tagKind describes the values accepted by a struct tag.
+type tagKind int
+
+const (
+	tagString tagKind = iota
+	tagBool
+	tagInt
+)
+
+// knownTags contains all struct tags interpreted by the parser.
+var knownTags = map[string]tagKind{
+	"abs-path":             tagBool,
+	"alias":                tagString,
+	"allow-dash-value":     tagBool,
+	"append-operator":      tagBool,
+	"base":                 tagInt,
+	"category":             tagString,
+	"choice":               tagString,
+	"clearable":            tagBool,
+	"command":              tagString,
+	"completion":           tagString,
+	"counter":              tagBool,
+	"default":              tagString,
+	"default-mask":         tagString,
+	"description":          tagString,
+	"env":                  tagString,
+	"env-delim":            tagString,
+	"env-namespace":        tagString,
+	"experimental":         tagBool,
+	"greedy":               tagBool,
+	"group":                tagString,
+	"help-priority":        tagInt,
+	"hidden":               tagBool,
+	"hide-subcommands":     tagBool,
+	"ini-name":             tagString,
+	"long":                 tagString,
+	"long-description":     tagString,
+	"map-delim":            tagString,
+	"max":                  tagInt,
+	"min":                  tagInt,
+	"namespace":            tagString,
+	"no-flag":              tagBool,
+	"no-ini":               tagBool,
+	"open-mode":            tagString,
+	"optional":             tagBool,
+	"optional-value":       tagString,
+	"os":                   tagString,
+	"passthrough":          tagBool,
+	"positional-arg-name":  tagString,
+	"positional-args":      tagBool,
+	"positional-rest":      tagBool,
+	"required":             tagBool,
+	"sep":                  tagString,
+	"setter":               tagBool,
+	"short":                tagString,
+	"short-aliases":        tagString,
+	"subcommands-optional": tagBool,
+	"subcommands-required": tagBool,
+	"summary":              tagString,
+	"time-format":          tagString,
+	"units":                tagString,
+	"unquote":              tagBool,
+	"url-require-scheme":   tagBool,
+	"value-name":           tagString,
+}
+
+// ValidateTags checks the struct tags of the data of all groups and commands
+// of the parser, and returns an error of type ErrInvalidTag for the first
+// unknown tag key (e.g. a misspelled descriptoin) or invalid tag value (e.g.
+// required:"maybe"), naming the path of the offending struct field. Malformed
+// tags result in an error of type ErrTag. Tags used by other packages (e.g.
+// json) need to be passed as ignore. Commands added with AddCommandLazy are
+// only checked once their data has been created.
+//
+// The parser itself ignores unknown tags, so calling ValidateTags is
+// optional; it is meant to catch mistakes in the tags early, e.g. in a test.
+func (p *Parser) ValidateTags(ignore ...string) error {
+	v := &tagValidator{
+		ignore:  make(map[string]bool, len(ignore)),
+		visited: make(map[reflect.Type]bool),
+	}
+
+	for _, key := range ignore {
+		v.ignore[key] = true
+	}
+
+	var err error
+
+	p.eachCommand(func(c *Command) {
+		c.eachGroup(func(g *Group) {
+			if err != nil || g.isBuiltinHelp || g.data == nil {
+				return
+			}
+
+			err = v.validateStruct(reflect.TypeOf(g.data), "", false)
+		})
+	}, true)
+
+	return err
+}
+
+type tagValidator struct {
+	ignore  map[string]bool
+	visited map[reflect.Type]bool
+}
+
+func (v *tagValidator) validateStruct(tp reflect.Type, path string, positional bool) error {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if tp.Kind() != reflect.Struct || v.visited[tp] {
+		return nil
+	}
+
+	v.visited[tp] = true
+
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+
+		// Unexported fields are ignored by the parser as well
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		fieldPath := field.Name
+
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+
+		mtag := newMultiTag(string(field.Tag))
+
+		if err := mtag.Parse(); err != nil {
+			return newErrorf(ErrTag, "invalid tag of field `%s': %s", fieldPath, err)
+		}
+
+		keys := make([]string, 0, len(mtag.cache))
+
+		for key := range mtag.cache {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if v.ignore[key] {
+				continue
+			}
+
+			kind, ok := knownTags[key]
+
+			if !ok {
+				return newErrorf(ErrInvalidTag,
+					"unknown tag `%s' on field `%s'",
+					key, fieldPath)
+			}
+
+			for _, value := range mtag.GetMany(key) {
+				if msg := checkTagValue(kind, key, value, positional); msg != "" {
+					return newErrorf(ErrInvalidTag,
+						"invalid value `%s' of tag `%s' on field `%s': expected %s",
+						value, key, fieldPath, msg)
+				}
+			}
+		}
+
+		// Follow the fields the parser scans for options, groups, commands
+		// and positional arguments
+		if isStringFalsy(mtag.Get("setter")) && mtag.Get("no-flag") == "" {
+			isPositional := !isStringFalsy(mtag.Get("positional-args"))
+
+			if err := v.validateStruct(field.Type, fieldPath, isPositional); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkTagValue returns a description of the expected values if value is not
+// a valid value of the tag, or an empty string otherwise.
+func checkTagValue(kind tagKind, key string, value string, positional bool) string {
+	if value == "" {
+		return ""
+	}
+
+	// The required tag of positional arguments may give the minimum, or a
+	// range, of the number of rest arguments
+	if positional && key == "required" {
+		if isBoolValue(value) {
+			return ""
+		}
+
+		for _, n := range strings.SplitN(value, "-", 2) {
+			if _, err := strconv.Atoi(n); err != nil {
+				return "a boolean, a number or a range of numbers"
+			}
+		}
+
+		return ""
+	}
+
+	switch kind {
+	case tagBool:
+		if !isBoolValue(value) {
+			return "a boolean"
+		}
+	case tagInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "an integer"
+		}
+	}
+
+	return ""
+}
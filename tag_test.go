@@ -1,6 +1,10 @@
 package flags
 
 import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -36,3 +40,86 @@ something"`
 
 	assertParseFail(t, ErrTag, "unexpected newline in tag value `description' (in `long:\"verbose\" description:\"verbose\nsomething\"`)", &opts, "")
 }
+
+func TestValidateTags(t *testing.T) {
+	var opts = struct {
+		Verbose []bool `short:"v" long:"verbose" description:"Verbose output" json:"verbose"`
+
+		Group struct {
+			Level int `long:"level" required:"yes" base:"16"`
+		} `group:"Group" namespace:"group"`
+
+		Command struct {
+			Positional struct {
+				Rest []string `required:"1-2"`
+			} `positional-args:"yes"`
+		} `command:"command" subcommands-optional:"true"`
+	}{}
+
+	p := NewParser(&opts, None)
+
+	assertError(t, p.ValidateTags(), ErrInvalidTag, "unknown tag `json' on field `Verbose'")
+
+	if err := p.ValidateTags("json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateTagsInvalid(t *testing.T) {
+	var unknown = struct {
+		Group struct {
+			Value string `long:"value" descriptoin:"A value"`
+		} `group:"Group"`
+	}{}
+
+	p := NewParser(&unknown, None)
+	assertError(t, p.ValidateTags(), ErrInvalidTag, "unknown tag `descriptoin' on field `Group.Value'")
+
+	var invalidBool = struct {
+		Value string `long:"value" required:"maybe"`
+	}{}
+
+	p = NewParser(&invalidBool, None)
+	assertError(t, p.ValidateTags(), ErrInvalidTag, "invalid value `maybe' of tag `required' on field `Value': expected a boolean")
+
+	var invalidInt = struct {
+		Command struct {
+			Value int `long:"value" base:"hex"`
+		} `command:"command"`
+	}{}
+
+	p = NewParser(&invalidInt, None)
+	assertError(t, p.ValidateTags(), ErrInvalidTag, "invalid value `hex' of tag `base' on field `Command.Value': expected an integer")
+}
+
+func TestValidateTagsDocumented(t *testing.T) {
+	doc, err := ioutil.ReadFile("flags.go")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tags are documented as "    name: description" in flags.go
+	matches := regexp.MustCompile(`(?m)^    ([a-z][a-z-]*):`).FindAllSubmatch(doc, -1)
+
+	if len(matches) == 0 {
+		t.Fatal("Expected to find the documented tags in flags.go")
+	}
+
+	fields := make([]reflect.StructField, 0, len(matches))
+
+	for i, m := range matches {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i),
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf("%s:\"\"", m[1])),
+		})
+	}
+
+	data := reflect.New(reflect.StructOf(fields)).Interface()
+	p := NewParser(data, None)
+
+	if err := p.ValidateTags(); err != nil {
+		t.Errorf("Unexpected error for the tags documented in flags.go: %v", err)
+	}
+}
@@ -64,3 +64,39 @@ func TestIgnoreUnknownFlags(t *testing.T) {
 		t.Fatalf("Expected %v but got %v", exargs, args)
 	}
 }
+
+func TestPassUnknownAsArgs(t *testing.T) {
+	var opts = struct {
+		Verbose []bool `short:"v" long:"verbose" description:"Verbose output"`
+	}{}
+
+	args := []string{
+		"hello",
+		"--foo", "bar",
+		"-v",
+		"--baz=qux",
+		"--flag", "--verbose",
+		"-f", "value",
+		"--last",
+	}
+
+	p := NewParser(&opts, PassUnknownAsArgs)
+	args, err := p.ParseArgs(args)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStringArray(t, args, []string{
+		"hello",
+		"--foo", "bar",
+		"--baz=qux",
+		"--flag",
+		"-f", "value",
+		"--last",
+	})
+
+	if len(opts.Verbose) != 2 {
+		t.Errorf("Expected Verbose to be set twice, but got %v", opts.Verbose)
+	}
+}